@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Account struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (api *API) getAccounts(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	rows, err := api.db.Query(ctx,
+		"SELECT id, name, created_at FROM accounts WHERE user_id = $1 ORDER BY name", currentUserID(c))
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	accounts := []Account{}
+	for rows.Next() {
+		var a Account
+		if err := rows.Scan(&a.ID, &a.Name, &a.CreatedAt); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		accounts = append(accounts, a)
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, accounts)
+}
+
+func (api *API) createAccount(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	var input struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	a := Account{Name: strings.TrimSpace(input.Name)}
+	if a.Name == "" {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "name must not be blank")
+		return
+	}
+
+	err := api.db.QueryRow(ctx,
+		"INSERT INTO accounts (name, user_id) VALUES ($1, $2) RETURNING id, created_at", a.Name, currentUserID(c)).
+		Scan(&a.ID, &a.CreatedAt)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, a)
+}
+
+// accountExists reports whether accountID names one of the user's accounts.
+// Writes check this up front so a bad account_id is a clear 400 rather than
+// a foreign key violation.
+func (api *API) accountExists(ctx context.Context, userID string, accountID int) (bool, error) {
+	var exists bool
+	err := api.db.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM accounts WHERE id = $1 AND user_id = $2)", accountID, userID).Scan(&exists)
+	return exists, err
+}
+
+// checkAccount validates an optional account_id from a request body, writing
+// the error response and returning false when it is unusable.
+func (api *API) checkAccount(ctx context.Context, c *gin.Context, accountID *int) bool {
+	if accountID == nil {
+		return true
+	}
+	exists, err := api.accountExists(ctx, currentUserID(c), *accountID)
+	if err != nil {
+		respondDBError(c, err)
+		return false
+	}
+	if !exists {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Account not found")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	defaultAnomalyThreshold = 3.0
+	maxAnomalyThreshold     = 10.0
+	defaultAnomalyLimit     = 50
+	maxAnomalyLimit         = 500
+
+	// minAnomalySample is how many other debits a merchant needs before its
+	// spread is trusted enough to call anything unusual
+	minAnomalySample = 5
+)
+
+// Anomaly is a debit far larger than the caller's other debits at the same
+// merchant. Merchant is the grouping used by the merchant stats, falling back
+// to the description.
+type Anomaly struct {
+	Transaction Transaction     `json:"transaction"`
+	Merchant    string          `json:"merchant"`
+	ZScore      float64         `json:"z_score"`
+	Mean        decimal.Decimal `json:"mean"`
+	Stddev      decimal.Decimal `json:"stddev"`
+	SampleSize  int             `json:"sample_size"`
+}
+
+// anomalySource scores each live debit against the other debits in its
+// merchant group. Leaving the debit itself out of the mean and standard
+// deviation keeps one huge charge from inflating the spread that is meant to
+// expose it. The other debits' variance comes from windowed sums:
+// var = (sumsq - sum^2 / n) / (n - 1) over the n = count - 1 others. $1 must
+// be the user id, as userFilter arranges.
+const anomalySource = "(SELECT *, (amount - mean) / NULLIF(stddev, 0) AS z_score FROM (" +
+	"SELECT *, (total - amount) / (n - 1) AS mean, " +
+	"sqrt(GREATEST((total_sq - amount * amount - (total - amount) ^ 2 / (n - 1)) / (n - 2), 0)) AS stddev FROM (" +
+	"SELECT *, COALESCE(merchant, description) AS bucket, COUNT(*) OVER w AS n, " +
+	"SUM(amount) OVER w AS total, SUM(amount * amount) OVER w AS total_sq " +
+	"FROM transactions WHERE user_id = $1 AND deleted_at IS NULL AND type = 'debit' " +
+	"WINDOW w AS (PARTITION BY COALESCE(merchant, description))) AS grouped " +
+	"WHERE n - 1 >= %d) AS others) AS transactions"
+
+// getAnomalies lists debits more than threshold standard deviations above
+// the mean of their merchant's other debits, most unusual first. from and to
+// limit which debits are flagged, not the history they are compared with.
+func (api *API) getAnomalies(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	threshold := defaultAnomalyThreshold
+	if v := c.Query("threshold"); v != "" {
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil || t <= 0 || t > maxAnomalyThreshold {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest,
+				fmt.Sprintf("threshold must be greater than 0 and at most %g", maxAnomalyThreshold))
+			return
+		}
+		threshold = t
+	}
+	limit := defaultAnomalyLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAnomalyLimit {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest,
+				fmt.Sprintf("limit must be between 1 and %d", maxAnomalyLimit))
+			return
+		}
+		limit = n
+	}
+
+	filter := userFilter(c)
+	if err := filter.addDateRange(c); err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	filter.add("z_score > $%d", threshold)
+
+	args := append(filter.args, limit)
+	rows, err := api.db.Query(ctx,
+		fmt.Sprintf("SELECT %s, bucket, z_score, mean, stddev, n - 1 FROM %s%s ORDER BY z_score DESC, id LIMIT $%d",
+			transactionColumns, fmt.Sprintf(anomalySource, minAnomalySample), filter.where(), len(args)),
+		args...)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	anomalies := []Anomaly{}
+	for rows.Next() {
+		var a Anomaly
+		fields := append(transactionFields(&a.Transaction), &a.Merchant, &a.ZScore, &a.Mean, &a.Stddev, &a.SampleSize)
+		if err := rows.Scan(fields...); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		a.Mean = a.Mean.Round(2)
+		a.Stddev = a.Stddev.Round(2)
+		anomalies = append(anomalies, a)
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, anomalies)
+}
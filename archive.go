@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// archiveTransactions copies the caller's live transactions dated before the
+// before parameter into transaction_archive and soft-deletes them, in one
+// statement so neither half can happen without the other. Only live rows are
+// picked up, so retrying a request that already succeeded archives nothing
+// more. With format=csv the archived rows are returned as an attachment.
+func (api *API) archiveTransactions(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	v := c.Query("before")
+	if v == "" {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "before is required")
+		return
+	}
+	before, _, err := parseDateParam(v)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("invalid before date %q: use RFC3339 or YYYY-MM-DD", v))
+		return
+	}
+	if before.After(time.Now()) {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "before must not be in the future")
+		return
+	}
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("invalid format %q: must be json or csv", format))
+		return
+	}
+
+	// A transaction restored after an earlier archive is archived afresh. The
+	// outer deleted_at check makes a concurrent duplicate request skip rows
+	// the first one has already taken.
+	rows, err := api.db.Query(ctx,
+		"WITH archived AS ("+
+			"INSERT INTO transaction_archive (transaction_id, user_id, date, data) "+
+			"SELECT id, user_id, date, to_jsonb(transactions) FROM transactions "+
+			"WHERE user_id = $1 AND deleted_at IS NULL AND date < $2 "+
+			"ON CONFLICT (transaction_id) DO UPDATE SET data = EXCLUDED.data, archived_at = now() "+
+			"RETURNING transaction_id) "+
+			"UPDATE transactions SET deleted_at = now() "+
+			"WHERE id IN (SELECT transaction_id FROM archived) AND deleted_at IS NULL RETURNING "+transactionColumns,
+		currentUserID(c), before)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	archived := []Transaction{}
+	for rows.Next() {
+		var t Transaction
+		if err := scanTransaction(rows, &t); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		archived = append(archived, t)
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	if format == "json" {
+		c.JSON(http.StatusOK, gin.H{"archived": len(archived)})
+		return
+	}
+
+	sort.Slice(archived, func(i, j int) bool {
+		if !archived[i].Date.Equal(archived[j].Date) {
+			return archived[i].Date.Before(archived[j].Date)
+		}
+		return archived[i].ID < archived[j].ID
+	})
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="archive-before-%s.csv"`, before.Format(time.DateOnly)))
+	c.Header("X-Archived-Count", fmt.Sprint(len(archived)))
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write(csvHeader)
+	for i := range archived {
+		w.Write(csvRecord(&archived[i]))
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		c.Error(err)
+	}
+}
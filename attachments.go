@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	defaultAttachmentsDir = "attachments"
+
+	// maxAttachmentSize caps a single uploaded file
+	maxAttachmentSize = 10 << 20
+
+	maxAttachmentFilename = 255
+)
+
+// attachmentTypes are the content types an attachment may have, as sniffed
+// from the file itself rather than taken from the client.
+var attachmentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+}
+
+type Attachment struct {
+	ID            int       `json:"id"`
+	TransactionID int       `json:"transaction_id"`
+	Filename      string    `json:"filename"`
+	ContentType   string    `json:"content_type"`
+	Size          int64     `json:"size"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+const attachmentColumns = "id, transaction_id, filename, content_type, size, created_at"
+
+func scanAttachment(row pgx.Row, a *Attachment) error {
+	return row.Scan(&a.ID, &a.TransactionID, &a.Filename, &a.ContentType, &a.Size, &a.CreatedAt)
+}
+
+// createAttachment stores an uploaded receipt or other file against a
+// transaction. The file is written to disk before its row is inserted, and
+// removed again if the insert fails, so a row never points at nothing.
+func (api *API) createAttachment(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		respondUploadError(c, err, "A file upload named \"file\" is required")
+		return
+	}
+	if file.Size > maxAttachmentSize {
+		respondError(c, http.StatusRequestEntityTooLarge, codeInvalidRequest,
+			fmt.Sprintf("Attachments must be at most %s", formatBytes(maxAttachmentSize)))
+		return
+	}
+	if !checkTaggable(ctx, c, api.db, c.Param("id")) {
+		return
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "unable to read upload")
+		return
+	}
+	contentType, _, _ := strings.Cut(http.DetectContentType(head[:n]), ";")
+	if !attachmentTypes[contentType] {
+		respondError(c, http.StatusUnsupportedMediaType, codeInvalidRequest,
+			fmt.Sprintf("Unsupported attachment type %s: must be a JPEG, PNG, GIF or WebP image, or a PDF", contentType))
+		return
+	}
+
+	key, err := newStorageKey()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternal, "Unable to store attachment")
+		return
+	}
+	path, err := api.writeAttachment(key, io.MultiReader(bytes.NewReader(head[:n]), f))
+	if err != nil {
+		api.logger.Error("writing attachment failed", "error", err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Unable to store attachment")
+		return
+	}
+
+	a := Attachment{Filename: attachmentFilename(file.Filename), ContentType: contentType, Size: file.Size}
+	err = scanAttachment(api.db.QueryRow(ctx,
+		"INSERT INTO attachments (transaction_id, user_id, filename, content_type, size, storage_key) "+
+			"VALUES ($1, $2, $3, $4, $5, $6) RETURNING "+attachmentColumns,
+		c.Param("id"), currentUserID(c), a.Filename, a.ContentType, a.Size, key), &a)
+	if err != nil {
+		os.Remove(path)
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, a)
+}
+
+// getAttachments lists a transaction's attachments, oldest first.
+func (api *API) getAttachments(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	if !checkTaggable(ctx, c, api.db, c.Param("id")) {
+		return
+	}
+
+	rows, err := api.db.Query(ctx,
+		"SELECT "+attachmentColumns+" FROM attachments WHERE transaction_id = $1 AND user_id = $2 ORDER BY id",
+		c.Param("id"), currentUserID(c))
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	attachments := []Attachment{}
+	for rows.Next() {
+		var a Attachment
+		if err := scanAttachment(rows, &a); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		attachments = append(attachments, a)
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, attachments)
+}
+
+// downloadAttachment sends an attachment's file with the content type it was
+// stored under.
+func (api *API) downloadAttachment(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	if !checkTaggable(ctx, c, api.db, c.Param("id")) {
+		return
+	}
+
+	var a Attachment
+	var key string
+	err := api.db.QueryRow(ctx,
+		"SELECT "+attachmentColumns+", storage_key FROM attachments WHERE id = $1 AND transaction_id = $2 AND user_id = $3",
+		c.Param("attachmentID"), c.Param("id"), currentUserID(c)).
+		Scan(&a.ID, &a.TransactionID, &a.Filename, &a.ContentType, &a.Size, &a.CreatedAt, &key)
+	if errors.Is(err, pgx.ErrNoRows) {
+		respondError(c, http.StatusNotFound, codeNotFound, "Attachment not found")
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	path := api.attachmentPath(key)
+	if _, err := os.Stat(path); err != nil {
+		api.logger.Error("attachment file missing", "attachment_id", a.ID, "error", err)
+		respondError(c, http.StatusNotFound, codeNotFound, "Attachment not found")
+		return
+	}
+	// ServeFile keeps a Content-Type that is already set
+	c.Header("Content-Type", a.ContentType)
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.FileAttachment(path, a.Filename)
+}
+
+// writeAttachment copies r to a new file named key under the attachments
+// directory, via a temporary file so a partial write is never left behind
+// under the final name.
+func (api *API) writeAttachment(key string, r io.Reader) (string, error) {
+	if err := os.MkdirAll(api.attachmentsDir, 0o750); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(api.attachmentsDir, ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	path := api.attachmentPath(key)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func (api *API) attachmentPath(key string) string {
+	return filepath.Join(api.attachmentsDir, key)
+}
+
+// newStorageKey names a stored file. It is random, so nothing about the
+// upload, least of all its client-supplied name, reaches the filesystem.
+func newStorageKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// attachmentFilename keeps the base of the client's filename for
+// Content-Disposition, falling back to a generic name.
+func attachmentFilename(name string) string {
+	name = strings.TrimSpace(filepath.Base(strings.ReplaceAll(name, "\\", "/")))
+	if name == "" || name == "." || name == ".." || name == "/" {
+		return "attachment"
+	}
+	if len(name) > maxAttachmentFilename {
+		name = strings.ToValidUTF8(name[:maxAttachmentFilename], "")
+	}
+	return name
+}
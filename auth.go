@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Gin context keys set by requireAuth.
+const (
+	claimsKey = "claims"
+	userIDKey = "user_id"
+)
+
+// requireAuth rejects requests that don't carry a valid HS256 Bearer token
+// signed with the configured secret.
+func (api *API) requireAuth(c *gin.Context) {
+	if len(api.jwtSecret) == 0 {
+		respondError(c, http.StatusInternalServerError, codeInternal, "Authentication is not configured")
+		return
+	}
+
+	header := c.GetHeader("Authorization")
+	tokenString, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || tokenString == "" {
+		respondError(c, http.StatusUnauthorized, codeUnauthorized, "Missing bearer token")
+		return
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(*jwt.Token) (any, error) {
+		return api.jwtSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		respondError(c, http.StatusUnauthorized, codeUnauthorized, "Invalid token")
+		return
+	}
+
+	// The subject identifies the user that owns the data being accessed
+	subject, err := claims.GetSubject()
+	if err != nil || subject == "" {
+		respondError(c, http.StatusUnauthorized, codeUnauthorized, "Token has no subject")
+		return
+	}
+
+	c.Set(claimsKey, claims)
+	c.Set(userIDKey, subject)
+	c.Next()
+}
+
+// currentUserID returns the id of the user authenticated by requireAuth.
+func currentUserID(c *gin.Context) string {
+	return c.GetString(userIDKey)
+}
+
+// userFilter returns a filter restricted to rows owned by the current user.
+func userFilter(c *gin.Context) *transactionFilter {
+	f := &transactionFilter{}
+	f.add("user_id = $%d", currentUserID(c))
+	return f
+}
+
+// activeFilter returns a filter restricted to the current user's transactions
+// that haven't been soft-deleted.
+func activeFilter(c *gin.Context) *transactionFilter {
+	f := userFilter(c)
+	f.addCondition("deleted_at IS NULL")
+	return f
+}
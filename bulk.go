@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// maxBulkItems caps how many transactions one POST /transactions/bulk
+	// may carry
+	maxBulkItems = 1000
+
+	// maxBulkBodySize comfortably fits maxBulkItems ordinary transactions
+	maxBulkBodySize = 2 << 20
+)
+
+// bulkItemResult reports the outcome of one element of a bulk request, by its
+// position in the submitted array.
+type bulkItemResult struct {
+	Index       int          `json:"index"`
+	Status      string       `json:"status"`
+	Transaction *Transaction `json:"transaction,omitempty"`
+	Errors      []FieldError `json:"errors,omitempty"`
+}
+
+type bulkImportResult struct {
+	JobID   string           `json:"job_id,omitempty"`
+	Created int              `json:"created"`
+	Failed  int              `json:"failed"`
+	Results []bulkItemResult `json:"results"`
+}
+
+// bulkCreateTransactions validates each element of a JSON array on its own,
+// then inserts every valid one in a single database transaction under a new
+// job, so the load can be undone with the job restore/delete endpoints.
+// Invalid elements are reported and skipped rather than failing the request.
+func (api *API) bulkCreateTransactions(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	// limitBody allows this route up to maxBulkBodySize
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		respondBodyError(c, err)
+		return
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(body, &items); err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Request body must be a JSON array of transactions")
+		return
+	}
+	if len(items) == 0 {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "At least one transaction is required")
+		return
+	}
+	if len(items) > maxBulkItems {
+		respondError(c, http.StatusRequestEntityTooLarge, codeInvalidRequest,
+			fmt.Sprintf("At most %d transactions may be submitted at once", maxBulkItems))
+		return
+	}
+
+	userID := currentUserID(c)
+	result := bulkImportResult{Results: make([]bulkItemResult, len(items))}
+	pending := make([]*Transaction, len(items))
+	var accountIDs []int
+	for i, raw := range items {
+		result.Results[i].Index = i
+
+		var input transactionInput
+		if err := binding.JSON.BindBody(raw, &input); err != nil {
+			result.Results[i].Errors = bindErrorFields(err)
+			continue
+		}
+		if fields := api.dateErrors(&input.Date); fields != nil {
+			result.Results[i].Errors = fields
+			continue
+		}
+		pending[i] = &Transaction{
+			Date:        input.Date,
+			Description: input.Description,
+			Amount:      *input.Amount,
+			Currency:    input.currency(),
+			Type:        input.Type,
+			Category:    input.Category,
+			Note:        input.Note,
+			AccountID:   input.AccountID,
+		}
+		if input.AccountID != nil {
+			accountIDs = append(accountIDs, *input.AccountID)
+		}
+	}
+
+	// Accounts are checked in one query rather than once per element
+	owned := make(map[int]bool)
+	if len(accountIDs) > 0 {
+		rows, err := api.db.Query(ctx, "SELECT id FROM accounts WHERE user_id = $1 AND id = ANY($2)", userID, accountIDs)
+		if err != nil {
+			respondDBError(c, err)
+			return
+		}
+		ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+		if err != nil {
+			respondDBError(c, err)
+			return
+		}
+		for _, id := range ids {
+			owned[id] = true
+		}
+	}
+
+	valid := 0
+	for i, t := range pending {
+		if t != nil && t.AccountID != nil && !owned[*t.AccountID] {
+			result.Results[i].Errors = []FieldError{{Field: "account_id", Message: "account not found"}}
+			pending[i] = nil
+		}
+		if pending[i] != nil {
+			valid++
+		}
+	}
+
+	if valid == 0 {
+		for i := range result.Results {
+			result.Results[i].Status = "failed"
+		}
+		result.Failed = len(items)
+		respondErrorDetails(c, http.StatusUnprocessableEntity, codeValidationFailed, "No valid transactions to insert", result)
+		return
+	}
+
+	tx, err := api.db.Begin(ctx)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// The job is written already complete: the load either commits whole or
+	// not at all, so it is never observed part way through
+	if err := tx.QueryRow(ctx,
+		"INSERT INTO jobs (job_id, status, processed_count, total_count, user_id) "+
+			"VALUES (gen_random_uuid()::text, 'completed', $1, $1, $2) RETURNING job_id",
+		valid, userID).Scan(&result.JobID); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	batch := &pgx.Batch{}
+	for _, t := range pending {
+		if t == nil {
+			continue
+		}
+		t.JobID = &result.JobID
+		batch.Queue(
+			"INSERT INTO transactions (date, description, amount, currency, type, category, note, account_id, job_id, user_id) "+
+				"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING "+transactionColumns,
+			t.Date, t.Description, t.Amount, t.Currency, t.Type, t.Category, t.Note, t.AccountID, result.JobID, userID)
+	}
+	br := tx.SendBatch(ctx, batch)
+	for i, t := range pending {
+		if t == nil {
+			continue
+		}
+		if err := scanTransaction(br.QueryRow(), t); err != nil {
+			br.Close()
+			status, code, msg := classifyDBError(err)
+			respondError(c, status, code, fmt.Sprintf("%s at index %d; nothing was inserted", msg, i))
+			return
+		}
+	}
+	if err := br.Close(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	var created []int
+	for i, t := range pending {
+		if t == nil {
+			result.Results[i].Status = "failed"
+			result.Failed++
+			continue
+		}
+		result.Results[i].Status = "created"
+		result.Results[i].Transaction = t
+		result.Created++
+		created = append(created, t.ID)
+	}
+	api.notifyWebhooks(userID, eventTransactionCreated, created...)
+	c.JSON(http.StatusCreated, result)
+}
+
+// bindErrorFields describes why a single element failed to bind, in the same
+// shape respondBindError uses for whole request bodies.
+func bindErrorFields(err error) []FieldError {
+	var verrs validator.ValidationErrors
+	if errors.As(err, &verrs) {
+		return fieldErrors("", verrs)
+	}
+	return []FieldError{{Message: err.Error()}}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// clearTransaction marks a transaction as reconciled against the bank.
+func (api *API) clearTransaction(c *gin.Context) {
+	api.setCleared(c, true)
+}
+
+func (api *API) unclearTransaction(c *gin.Context) {
+	api.setCleared(c, false)
+}
+
+func (api *API) setCleared(c *gin.Context, cleared bool) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	var t Transaction
+	err := scanTransaction(api.db.QueryRow(ctx,
+		"UPDATE transactions SET cleared = $1, version = version + 1 WHERE id = $2 AND user_id = $3 AND deleted_at IS NULL RETURNING "+transactionColumns,
+		cleared, c.Param("id"), currentUserID(c)), &t)
+	if errors.Is(err, pgx.ErrNoRows) {
+		respondError(c, http.StatusNotFound, codeNotFound, "Transaction not found")
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, t)
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	defaultDatabaseURL = "postgresql://junpark@localhost:5432/bankstatements"
+	defaultListenAddr  = ":8050"
+)
+
+// Config holds the settings an API is built with. DefaultConfig returns the
+// built-in values; NewAPI reads overrides from the environment.
+type Config struct {
+	// JWTSecret verifies bearer tokens. While it is empty every protected
+	// route answers 500 rather than trust unsigned requests
+	JWTSecret    []byte
+	QueryTimeout time.Duration
+	// DefaultPageLimit applies when a list request gives no limit, and
+	// larger limits are capped at MaxPageLimit
+	DefaultPageLimit int
+	MaxPageLimit     int
+	// AllowedOrigins may make cross-origin requests; empty denies them all
+	AllowedOrigins []string
+	// StatsCacheTTL is how long stats are served from memory; zero turns
+	// the cache off
+	StatsCacheTTL time.Duration
+	// BaseCurrency is the ISO 4217 code stats are reported in
+	BaseCurrency string
+	// ImportDateFormats are tried in order on imported dates, e.g. DD/MM/YYYY
+	ImportDateFormats []string
+	AttachmentsDir    string
+	MaxBodySize       int64
+	MaxUploadSize     int64
+	// RateLimit is each user's requests per second, in bursts of up to
+	// RateBurst; zero turns limiting off
+	RateLimit float64
+	RateBurst int
+	// IPRateLimit and IPRateBurst are the same per client IP, checked
+	// before the bearer token
+	IPRateLimit    float64
+	IPRateBurst    int
+	ImportWorkers  int
+	WebhookWorkers int
+	LogLevel       string
+	// MaxFutureDays is how many days ahead of now a transaction may be
+	// dated, in requests and imports alike; anything later is almost
+	// certainly a typo in the year
+	MaxFutureDays int
+	// ReadHeaderTimeout, ReadTimeout, WriteTimeout and IdleTimeout are
+	// applied to the http.Server by Run
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// ReadReplica, when set, serves the reads routed through API.reader
+	ReadReplica Database
+}
+
+// DefaultConfig returns the settings used when nothing is configured.
+func DefaultConfig() Config {
+	return Config{
+		QueryTimeout:      defaultQueryTimeout,
+		DefaultPageLimit:  defaultPageLimit,
+		MaxPageLimit:      maxPageLimit,
+		StatsCacheTTL:     defaultStatsCacheTTL,
+		BaseCurrency:      defaultCurrency,
+		ImportDateFormats: slices.Clone(defaultImportDateFormats),
+		AttachmentsDir:    defaultAttachmentsDir,
+		MaxBodySize:       defaultMaxBodySize,
+		MaxUploadSize:     defaultMaxUploadSize,
+		RateLimit:         defaultRateLimit,
+		RateBurst:         defaultRateBurst,
+		IPRateLimit:       defaultIPRateLimit,
+		IPRateBurst:       defaultIPRateBurst,
+		ImportWorkers:     defaultImportWorkers,
+		WebhookWorkers:    defaultWebhookWorkers,
+		MaxFutureDays:     defaultMaxFutureDays,
+		ReadHeaderTimeout: defaultReadHeaderTimeout,
+		ReadTimeout:       defaultReadTimeout,
+		WriteTimeout:      defaultWriteTimeout,
+		IdleTimeout:       defaultIdleTimeout,
+	}
+}
+
+// configFromEnv overlays DefaultConfig with the environment. Invalid values
+// are logged and ignored, so the result is always valid.
+func configFromEnv() Config {
+	cfg := DefaultConfig()
+	cfg.JWTSecret = []byte(os.Getenv("JWT_SECRET"))
+	cfg.QueryTimeout = envDuration("QUERY_TIMEOUT", cfg.QueryTimeout)
+	for origin := range parseAllowedOrigins(os.Getenv("ALLOWED_ORIGINS")) {
+		cfg.AllowedOrigins = append(cfg.AllowedOrigins, origin)
+	}
+	cfg.StatsCacheTTL = envDuration("STATS_CACHE_TTL", cfg.StatsCacheTTL)
+	cfg.BaseCurrency = parseBaseCurrency(os.Getenv("BASE_CURRENCY"))
+	cfg.ImportDateFormats = parseImportDateFormats(os.Getenv("IMPORT_DATE_FORMATS"))
+	cfg.AttachmentsDir = envOrDefault("ATTACHMENTS_DIR", cfg.AttachmentsDir)
+	cfg.MaxBodySize = int64(envInt("MAX_BODY_SIZE", int(cfg.MaxBodySize)))
+	cfg.MaxUploadSize = int64(envInt("MAX_UPLOAD_SIZE", int(cfg.MaxUploadSize)))
+	cfg.RateLimit = envFloat("RATE_LIMIT_RPS", cfg.RateLimit)
+	cfg.RateBurst = envInt("RATE_LIMIT_BURST", cfg.RateBurst)
+	cfg.IPRateLimit = envFloat("RATE_LIMIT_IP_RPS", cfg.IPRateLimit)
+	cfg.IPRateBurst = envInt("RATE_LIMIT_IP_BURST", cfg.IPRateBurst)
+	cfg.ImportWorkers = envInt("IMPORT_WORKERS", cfg.ImportWorkers)
+	cfg.WebhookWorkers = envInt("WEBHOOK_WORKERS", cfg.WebhookWorkers)
+	cfg.LogLevel = os.Getenv("LOG_LEVEL")
+	cfg.MaxFutureDays = envInt("MAX_FUTURE_DAYS", cfg.MaxFutureDays)
+	cfg.ReadHeaderTimeout = envDuration("READ_HEADER_TIMEOUT", cfg.ReadHeaderTimeout)
+	cfg.ReadTimeout = envDuration("READ_TIMEOUT", cfg.ReadTimeout)
+	cfg.WriteTimeout = envDuration("WRITE_TIMEOUT", cfg.WriteTimeout)
+	cfg.IdleTimeout = envDuration("IDLE_TIMEOUT", cfg.IdleTimeout)
+	return cfg
+}
+
+// validate reports the first setting that is out of range or inconsistent
+// with another.
+func (cfg Config) validate() error {
+	switch {
+	case cfg.QueryTimeout <= 0:
+		return errors.New("QueryTimeout must be positive")
+	case cfg.DefaultPageLimit <= 0 || cfg.MaxPageLimit <= 0:
+		return errors.New("DefaultPageLimit and MaxPageLimit must be positive")
+	case cfg.DefaultPageLimit > cfg.MaxPageLimit:
+		return fmt.Errorf("DefaultPageLimit (%d) exceeds MaxPageLimit (%d)", cfg.DefaultPageLimit, cfg.MaxPageLimit)
+	case cfg.StatsCacheTTL < 0:
+		return errors.New("StatsCacheTTL must not be negative")
+	case !currencyCodePattern.MatchString(cfg.BaseCurrency):
+		return fmt.Errorf("invalid BaseCurrency %q: must be an upper-case ISO 4217 code", cfg.BaseCurrency)
+	case len(cfg.ImportDateFormats) == 0:
+		return errors.New("ImportDateFormats must not be empty")
+	case cfg.AttachmentsDir == "":
+		return errors.New("AttachmentsDir must not be empty")
+	case cfg.MaxBodySize <= 0 || cfg.MaxUploadSize <= 0:
+		return errors.New("MaxBodySize and MaxUploadSize must be positive")
+	case cfg.RateLimit < 0:
+		return errors.New("RateLimit must not be negative")
+	case cfg.RateLimit > 0 && cfg.RateBurst <= 0:
+		return errors.New("RateBurst must be positive while RateLimit is set")
+	case cfg.IPRateLimit < 0:
+		return errors.New("IPRateLimit must not be negative")
+	case cfg.IPRateLimit > 0 && cfg.IPRateBurst <= 0:
+		return errors.New("IPRateBurst must be positive while IPRateLimit is set")
+	case cfg.ImportWorkers <= 0 || cfg.WebhookWorkers <= 0:
+		return errors.New("ImportWorkers and WebhookWorkers must be positive")
+	case cfg.MaxFutureDays <= 0:
+		return errors.New("MaxFutureDays must be positive")
+	case cfg.ReadHeaderTimeout <= 0 || cfg.ReadTimeout <= 0 || cfg.WriteTimeout <= 0 || cfg.IdleTimeout <= 0:
+		return errors.New("ReadHeaderTimeout, ReadTimeout, WriteTimeout and IdleTimeout must be positive")
+	}
+	for _, origin := range cfg.AllowedOrigins {
+		if strings.TrimSpace(origin) == "" {
+			return errors.New("AllowedOrigins must not contain blank entries")
+		}
+	}
+	if _, err := dateFormatLayouts(cfg.ImportDateFormats); err != nil {
+		return fmt.Errorf("invalid ImportDateFormats: %w", err)
+	}
+	return nil
+}
+
+// serverConfig holds the process-level settings read from the environment.
+type serverConfig struct {
+	DatabaseURL string
+	ListenAddr  string
+	Pool        *pgxpool.Config
+	// ReadPool configures the read replica; nil when none is set
+	ReadPool *pgxpool.Config
+	// Migrate applies pending schema migrations before serving
+	Migrate bool
+	// TraceEndpoint is the OTLP/HTTP collector URL; tracing is off when empty
+	TraceEndpoint string
+	TraceService  string
+	// SlowQueryThreshold is how long a query may run before it is logged;
+	// zero turns the log off
+	SlowQueryThreshold time.Duration
+}
+
+// loadServerConfig reads DATABASE_URL and LISTEN_ADDR (or PORT) from the
+// environment, falling back to local development defaults. READ_DATABASE_URL
+// optionally names a read replica, which gets the same pool settings as the
+// primary. Migrations run on boot unless MIGRATE_ON_BOOT is false. Traces are
+// exported when OTEL_EXPORTER_OTLP_ENDPOINT is set, and queries slower than
+// SLOW_QUERY_THRESHOLD are logged.
+func loadServerConfig() (serverConfig, error) {
+	cfg := serverConfig{
+		DatabaseURL:   envOrDefault("DATABASE_URL", defaultDatabaseURL),
+		ListenAddr:    defaultListenAddr,
+		Migrate:       true,
+		TraceEndpoint: strings.TrimSpace(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")),
+		TraceService:  envOrDefault("OTEL_SERVICE_NAME", defaultServiceName),
+	}
+	// envDuration only takes positive durations, so 0 is handled here
+	if strings.TrimSpace(os.Getenv("SLOW_QUERY_THRESHOLD")) != "0" {
+		cfg.SlowQueryThreshold = envDuration("SLOW_QUERY_THRESHOLD", defaultSlowQueryThreshold)
+	}
+
+	if v := strings.TrimSpace(os.Getenv("MIGRATE_ON_BOOT")); v != "" {
+		migrate, err := strconv.ParseBool(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid MIGRATE_ON_BOOT %q", v)
+		}
+		cfg.Migrate = migrate
+	}
+
+	pool, err := pgxpool.ParseConfig(cfg.DatabaseURL)
+	if err != nil {
+		return cfg, fmt.Errorf("invalid DATABASE_URL: %w", err)
+	}
+	if err := applyPoolSettings(pool); err != nil {
+		return cfg, err
+	}
+	cfg.Pool = pool
+
+	if v := strings.TrimSpace(os.Getenv("READ_DATABASE_URL")); v != "" {
+		readPool, err := pgxpool.ParseConfig(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid READ_DATABASE_URL: %w", err)
+		}
+		if err := applyPoolSettings(readPool); err != nil {
+			return cfg, err
+		}
+		cfg.ReadPool = readPool
+	}
+
+	if addr := strings.TrimSpace(os.Getenv("LISTEN_ADDR")); addr != "" {
+		cfg.ListenAddr = addr
+	} else if port := strings.TrimSpace(os.Getenv("PORT")); port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			return cfg, fmt.Errorf("invalid PORT %q", port)
+		}
+		cfg.ListenAddr = ":" + port
+	}
+
+	return cfg, nil
+}
+
+// applyPoolSettings overrides pool with the DB_* environment variables. Unset
+// variables keep pgxpool's defaults, or whatever pool_* parameters the
+// database URL carries.
+func applyPoolSettings(pool *pgxpool.Config) error {
+	pool.MaxConns = int32(envInt("DB_MAX_CONNS", int(pool.MaxConns)))
+	pool.MinConns = int32(envInt("DB_MIN_CONNS", int(pool.MinConns)))
+	pool.MaxConnLifetime = envDuration("DB_MAX_CONN_LIFETIME", pool.MaxConnLifetime)
+	pool.MaxConnIdleTime = envDuration("DB_MAX_CONN_IDLE_TIME", pool.MaxConnIdleTime)
+	if pool.MinConns > pool.MaxConns {
+		return fmt.Errorf("DB_MIN_CONNS (%d) exceeds DB_MAX_CONNS (%d)", pool.MinConns, pool.MaxConns)
+	}
+	return nil
+}
+
+// envOrDefault returns the trimmed value of the environment variable key, or
+// fallback when it is unset or blank.
+func envOrDefault(key, fallback string) string {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// envDuration parses the environment variable key as a time.Duration, falling
+// back when it is unset or invalid.
+func envDuration(key string, fallback time.Duration) time.Duration {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Printf("Ignoring invalid %s %q, using %s\n", key, v, fallback)
+		return fallback
+	}
+	return d
+}
+
+// envFloat parses the environment variable key as a float, falling back when
+// it is unset or invalid.
+func envFloat(key string, fallback float64) float64 {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 {
+		log.Printf("Ignoring invalid %s %q, using %v\n", key, v, fallback)
+		return fallback
+	}
+	return f
+}
+
+// envInt parses the environment variable key as a positive integer, falling
+// back when it is unset or invalid.
+func envInt(key string, fallback int) int {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		log.Printf("Ignoring invalid %s %q, using %d\n", key, v, fallback)
+		return fallback
+	}
+	return n
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseAllowedOrigins splits a comma-separated ALLOWED_ORIGINS value into a
+// lookup set, ignoring blank entries.
+func parseAllowedOrigins(v string) map[string]bool {
+	origins := make(map[string]bool)
+	for _, origin := range strings.Split(v, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins[origin] = true
+		}
+	}
+	return origins
+}
+
+// cors echoes the request Origin back only when it is on the allowlist, so
+// the browser blocks every other cross-origin caller. An empty allowlist
+// therefore denies all cross-origin requests.
+func (api *API) cors(c *gin.Context) {
+	origin := c.GetHeader("Origin")
+	allowed := origin != "" && api.allowedOrigins[origin]
+
+	c.Writer.Header().Add("Vary", "Origin")
+	if allowed {
+		c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-None-Match, "+idempotencyKeyHeader)
+		// Let scripts read the response headers clients act on
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "ETag, Link, Retry-After, X-Request-ID")
+	}
+
+	// Preflights are answered here, before authentication, since browsers
+	// never attach credentials to them. A plain OPTIONS falls through to the
+	// per-path handlers from registerOptions.
+	if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+		if origin != "" && !allowed {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+		return
+	}
+	c.Next()
+}
+
+// registerOptions adds an OPTIONS handler for every registered path that
+// lists the path's methods in the Allow header.
+func (api *API) registerOptions() {
+	methods := make(map[string][]string)
+	var paths []string
+	for _, route := range api.router.Routes() {
+		if _, ok := methods[route.Path]; !ok {
+			paths = append(paths, route.Path)
+		}
+		methods[route.Path] = append(methods[route.Path], route.Method)
+	}
+
+	for _, path := range paths {
+		allowed := append(methods[path], http.MethodOptions)
+		sort.Strings(allowed)
+		allow := strings.Join(allowed, ", ")
+		api.router.OPTIONS(path, func(c *gin.Context) {
+			c.Header("Allow", allow)
+			c.AbortWithStatus(http.StatusNoContent)
+		})
+	}
+}
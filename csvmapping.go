@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// importTargets are the fields a CSV column can be mapped to.
+var importTargets = map[string]bool{
+	"date": true, "description": true, "amount": true, "type": true, "category": true,
+}
+
+// importHeaderProfiles lists, per target, the headers banks are known to use
+// for it, most specific first. A file is matched against them when no
+// mapping is given.
+var importHeaderProfiles = map[string][]string{
+	"date":        {"date", "transaction date", "trans. date", "posting date", "posted date", "post date", "value date"},
+	"description": {"description", "transaction description", "details", "payee", "memo", "name", "narrative"},
+	"amount":      {"amount", "transaction amount", "amount (usd)", "value"},
+	"type":        {"type", "transaction type", "debit/credit", "dr/cr", "credit/debit"},
+	"category":    {"category", "transaction category"},
+}
+
+// csvImportOptions tailors CSV parsing to one bank's export. A nil Mapping
+// means the columns are detected from the header.
+type csvImportOptions struct {
+	// Mapping is each target's source column, by header name or zero-based
+	// index
+	Mapping map[string]importColumnRef
+	Dates   dateLayouts
+	// NegativeType is the type of a negative amount when the file has no
+	// type column: debit unless sign_convention says otherwise
+	NegativeType string
+}
+
+type importColumnRef struct {
+	Name  string
+	Index int
+}
+
+// importOption reads an import setting from the multipart form, falling back
+// to the query string.
+func importOption(c *gin.Context, name string) string {
+	if v, ok := c.GetPostForm(name); ok {
+		return strings.TrimSpace(v)
+	}
+	return strings.TrimSpace(c.Query(name))
+}
+
+// parseCSVImportOptions reads the mapping and sign_convention settings.
+func parseCSVImportOptions(c *gin.Context, dates dateLayouts) (csvImportOptions, error) {
+	opts := csvImportOptions{Dates: dates, NegativeType: "debit"}
+	switch v := importOption(c, "sign_convention"); v {
+	case "", "negative_debit":
+	case "negative_credit":
+		opts.NegativeType = "credit"
+	default:
+		return opts, fmt.Errorf("invalid sign_convention %q: must be negative_debit or negative_credit", v)
+	}
+
+	v := importOption(c, "mapping")
+	if v == "" {
+		return opts, nil
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(v), &raw); err != nil {
+		return opts, fmt.Errorf("mapping must be a JSON object of field to column name or index")
+	}
+	opts.Mapping = make(map[string]importColumnRef, len(raw))
+	for target, value := range raw {
+		if !importTargets[target] {
+			return opts, fmt.Errorf("mapping names unknown field %q: must be one of %s", target, strings.Join(sortedKeys(importTargets), ", "))
+		}
+		var ref importColumnRef
+		if err := json.Unmarshal(value, &ref.Index); err == nil {
+			if ref.Index < 0 {
+				return opts, fmt.Errorf("mapping for %q has negative column index %d", target, ref.Index)
+			}
+		} else if err := json.Unmarshal(value, &ref.Name); err == nil && strings.TrimSpace(ref.Name) != "" {
+			ref.Index = -1
+		} else {
+			return opts, fmt.Errorf("mapping for %q must be a column name or zero-based index", target)
+		}
+		opts.Mapping[target] = ref
+	}
+	return opts, nil
+}
+
+// resolveImportColumns returns the index of each mapped target in a CSV
+// header, failing when a required target has no column.
+func resolveImportColumns(header []string, mapping map[string]importColumnRef) (map[string]int, error) {
+	positions := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if _, dup := positions[name]; !dup {
+			positions[name] = i
+		}
+	}
+
+	columns := make(map[string]int)
+	if mapping != nil {
+		for target, ref := range mapping {
+			if ref.Index >= 0 {
+				if ref.Index >= len(header) {
+					return nil, fmt.Errorf("mapping for %q names column %d, but the file has %d columns", target, ref.Index, len(header))
+				}
+				columns[target] = ref.Index
+				continue
+			}
+			i, ok := positions[strings.ToLower(strings.TrimSpace(ref.Name))]
+			if !ok {
+				return nil, fmt.Errorf("mapping for %q names column %q, which the file doesn't have", target, ref.Name)
+			}
+			columns[target] = i
+		}
+	} else {
+		for target, names := range importHeaderProfiles {
+			for _, name := range names {
+				if i, ok := positions[name]; ok {
+					columns[target] = i
+					break
+				}
+			}
+		}
+	}
+
+	for _, target := range requiredImportColumns {
+		if _, ok := columns[target]; !ok {
+			return nil, fmt.Errorf("no column found for required field %q; name one with the mapping parameter", target)
+		}
+	}
+	return columns, nil
+}
+
+// dateFormatLayout turns a date_format such as DD/MM/YYYY into a Go time
+// layout. YYYY, YY, MM, M, DD and D are understood; any other letter is
+// rejected so a typo can't silently misread every date.
+func dateFormatLayout(format string) (string, error) {
+	tokens := []struct{ token, layout string }{
+		{"YYYY", "2006"}, {"YY", "06"}, {"MM", "01"}, {"M", "1"}, {"DD", "02"}, {"D", "2"},
+	}
+	var b strings.Builder
+	upper := strings.ToUpper(format)
+	hasYear, hasMonth, hasDay := false, false, false
+next:
+	for i := 0; i < len(upper); {
+		for _, t := range tokens {
+			if strings.HasPrefix(upper[i:], t.token) {
+				b.WriteString(t.layout)
+				i += len(t.token)
+				switch t.token[0] {
+				case 'Y':
+					hasYear = true
+				case 'M':
+					hasMonth = true
+				case 'D':
+					hasDay = true
+				}
+				continue next
+			}
+		}
+		ch := upper[i]
+		if ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' {
+			return "", fmt.Errorf("invalid date_format %q: only YYYY, YY, MM, M, DD and D may appear, with separators between", format)
+		}
+		b.WriteByte(ch)
+		i++
+	}
+	if !hasYear || !hasMonth || !hasDay {
+		return "", fmt.Errorf("invalid date_format %q: needs a year, a month and a day", format)
+	}
+	return b.String(), nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// oppositeType returns credit for debit and debit for credit.
+func oppositeType(t string) string {
+	if t == "debit" {
+		return "credit"
+	}
+	return "debit"
+}
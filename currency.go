@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// defaultCurrency is what transactions are recorded in when none is given,
+// matching the column default so imports and API writes agree.
+const defaultCurrency = "USD"
+
+var currencyCodePattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// CurrencyTotals are stats left in their original currency because no rate
+// to the base currency exists.
+type CurrencyTotals struct {
+	Currency          string          `json:"currency"`
+	TotalTransactions int             `json:"total_transactions"`
+	TotalDebits       decimal.Decimal `json:"total_debits"`
+	TotalCredits      decimal.Decimal `json:"total_credits"`
+}
+
+// parseBaseCurrency validates BASE_CURRENCY, falling back to defaultCurrency.
+// Only a bare three-letter code gets through, which is what lets
+// convertedSource inline it.
+func parseBaseCurrency(v string) string {
+	v = strings.ToUpper(strings.TrimSpace(v))
+	if v == "" {
+		return defaultCurrency
+	}
+	if !currencyCodePattern.MatchString(v) {
+		log.Printf("Ignoring invalid BASE_CURRENCY %q, using %s\n", v, defaultCurrency)
+		return defaultCurrency
+	}
+	return v
+}
+
+// convertedSource replaces the transactions table in stats queries, adding
+// base_rate, the latest known rate from the row's currency to base, and
+// base_amount, the amount converted at it. Both are NULL when there is no
+// rate for that currency.
+func convertedSource(base string) string {
+	rate := "CASE WHEN transactions.currency = '" + base + "' THEN 1 ELSE rates.rate END"
+	return "(SELECT transactions.*, " + rate + " AS base_rate, transactions.amount * " + rate + " AS base_amount " +
+		"FROM transactions LEFT JOIN LATERAL (SELECT rate FROM exchange_rates " +
+		"WHERE exchange_rates.currency = transactions.currency AND exchange_rates.base_currency = '" + base + "' " +
+		"ORDER BY effective_date DESC LIMIT 1) AS rates ON true) AS transactions"
+}
+
+// unconvertedTotals totals, per bucket and currency, the rows from source
+// that have no rate to the base currency, so breakdowns can report them the
+// way Stats.Unconverted does instead of mixing currencies. bucket is a SQL
+// expression for the text key callers match their own rows on, amount the
+// expression summed, and extra are arguments bucket refers to, numbered
+// after filter's.
+func (api *API) unconvertedTotals(ctx context.Context, source, bucket, amount string, filter *transactionFilter, extra ...any) (map[string][]CurrencyTotals, error) {
+	unconverted := filter.clone()
+	unconverted.addCondition("base_amount IS NULL")
+	rows, err := api.reader().Query(ctx,
+		"SELECT "+bucket+" AS bucket, currency, COUNT(*), "+
+			"COALESCE(SUM("+amount+") FILTER (WHERE type = 'debit'), 0), "+
+			"COALESCE(SUM("+amount+") FILTER (WHERE type = 'credit'), 0) "+
+			"FROM "+source+unconverted.where()+" GROUP BY bucket, currency ORDER BY bucket, currency",
+		append(slices.Clone(unconverted.args), extra...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := make(map[string][]CurrencyTotals)
+	for rows.Next() {
+		var key string
+		var t CurrencyTotals
+		if err := rows.Scan(&key, &t.Currency, &t.TotalTransactions, &t.TotalDebits, &t.TotalCredits); err != nil {
+			return nil, err
+		}
+		totals[key] = append(totals[key], t)
+	}
+	return totals, rows.Err()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	maxRetryAttempts = 3
+	retryBaseDelay   = 50 * time.Millisecond
+)
+
+// rowQuerier is satisfied by both *pgxpool.Pool and pgx.Tx, letting helpers
+// run inside or outside a database transaction.
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// Querier runs statements. *pgxpool.Pool and pgx.Tx satisfy it, and so can a
+// fake in tests.
+type Querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// Database is what an API needs from its connection pool: a Querier that can
+// also open transactions and answer readiness checks. *pgxpool.Pool
+// satisfies it. Pool metrics and the transaction stream's LISTEN need the
+// real pool, and are skipped with anything else.
+type Database interface {
+	Querier
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Ping(ctx context.Context) error
+}
+
+// reader returns the database for reads that tolerate replication lag: the
+// read replica when one is configured, else the primary. Handlers opt in one
+// by one, so anything that must see its own writes keeps using api.db.
+func (api *API) reader() Querier {
+	if api.replica != nil {
+		return api.replica
+	}
+	return api.db
+}
+
+// queryContext derives a context for a handler's database work from the
+// request context, bounded by the configured query timeout so a stuck query
+// can't hold a pool connection indefinitely.
+func (api *API) queryContext(c *gin.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(c.Request.Context(), api.queryTimeout)
+}
+
+// withRetry runs fn, retrying transient database errors with exponential
+// backoff. It gives up early rather than sleep past ctx's deadline. fn must be
+// safe to run more than once, so wrap reads and never plain inserts.
+func withRetry(ctx context.Context, fn func() error) error {
+	delay := retryBaseDelay
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt == maxRetryAttempts || !isTransientDBError(err) {
+			return err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// isTransientDBError reports whether err is likely to succeed on retry: a
+// dropped or refused connection, a serialization failure or a deadlock.
+func isTransientDBError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case pgErr.Code == "40001", pgErr.Code == "40P01":
+			return true
+		case len(pgErr.Code) == 5 && pgErr.Code[:2] == "08":
+			return true
+		}
+		return false
+	}
+
+	var connectErr *pgconn.ConnectError
+	return errors.As(err, &connectErr) || pgconn.SafeToRetry(err)
+}
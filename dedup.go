@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+// dedupHash fingerprints a transaction by its date, amount and description so
+// overlapping statement imports can be recognised. Descriptions are compared
+// case-insensitively and with surrounding whitespace removed.
+func dedupHash(t Transaction) string {
+	key := strings.Join([]string{
+		t.Date.UTC().Format(time.RFC3339),
+		t.Amount.StringFixed(2),
+		strings.ToLower(strings.TrimSpace(t.Description)),
+	}, "|")
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// fitidDedupHash fingerprints an OFX transaction by its bank-assigned FITID,
+// which is only unique within the account it was issued for.
+func fitidDedupHash(accountID, fitid string) string {
+	sum := sha256.Sum256([]byte("ofx|" + accountID + "|" + fitid))
+	return hex.EncodeToString(sum[:])
+}
+
+type DuplicateGroup struct {
+	Date           time.Time       `json:"date"`
+	Amount         decimal.Decimal `json:"amount"`
+	Description    string          `json:"description"`
+	Count          int             `json:"count"`
+	TransactionIDs []int           `json:"transaction_ids"`
+}
+
+// getDuplicates lists groups of active transactions that share the fields
+// used by dedupHash. The grouping is done on the fields themselves rather
+// than the stored hash so rows created before hashing existed are included.
+func (api *API) getDuplicates(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	filter := activeFilter(c)
+	rows, err := api.db.Query(ctx,
+		"SELECT date, amount, MIN(description), COUNT(*), array_agg(id ORDER BY id) "+
+			"FROM transactions"+filter.where()+" "+
+			"GROUP BY date, amount, lower(trim(description)) HAVING COUNT(*) > 1 ORDER BY date DESC",
+		filter.args...)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	groups := []DuplicateGroup{}
+	for rows.Next() {
+		var g DuplicateGroup
+		if err := rows.Scan(&g.Date, &g.Amount, &g.Description, &g.Count, &g.TransactionIDs); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		groups = append(groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, groups)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+)
+
+// dryRunSampleSize is how many parsed rows a dry run echoes back.
+const dryRunSampleSize = 20
+
+// dryRunRow is one parsed row as a dry run reports it. Status is "insert" or
+// "duplicate".
+type dryRunRow struct {
+	Line        int             `json:"line,omitempty"`
+	Date        time.Time       `json:"date"`
+	Description string          `json:"description"`
+	Merchant    string          `json:"merchant"`
+	Amount      decimal.Decimal `json:"amount"`
+	Type        string          `json:"type"`
+	Category    *string         `json:"category"`
+	Status      string          `json:"status"`
+}
+
+type dryRunResult struct {
+	Format      string `json:"format"`
+	Rows        int    `json:"rows"`
+	WouldInsert int    `json:"would_insert"`
+	Duplicates  int    `json:"duplicates"`
+	Invalid     int    `json:"invalid"`
+	// Errors describes the invalid rows, up to maxImportRowErrors of them
+	Errors []importRowError `json:"errors"`
+	Sample []dryRunRow      `json:"sample"`
+}
+
+// respondImportDryRun reports what importing rows would do without writing
+// anything. A row is a duplicate when a live transaction already has its
+// dedup hash, or an earlier row of the same file does, which is exactly what
+// the import's ON CONFLICT would skip.
+func (api *API) respondImportDryRun(c *gin.Context, format string, rows []importRow, invalid []importRowError) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	hashes := make([]string, len(rows))
+	for i, row := range rows {
+		hashes[i] = row.DedupHash
+	}
+	existing, err := api.db.Query(ctx,
+		"SELECT DISTINCT dedup_hash FROM transactions WHERE user_id = $1 AND deleted_at IS NULL AND dedup_hash = ANY($2)",
+		currentUserID(c), hashes)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	found, err := pgx.CollectRows(existing, pgx.RowTo[string])
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	seen := make(map[string]bool, len(rows)+len(found))
+	for _, h := range found {
+		seen[h] = true
+	}
+
+	result := dryRunResult{
+		Format:  format,
+		Rows:    len(rows) + len(invalid),
+		Invalid: len(invalid),
+		Errors:  append([]importRowError{}, reportedRowErrors(invalid)...),
+		Sample:  []dryRunRow{},
+	}
+	for _, row := range rows {
+		status := "insert"
+		if seen[row.DedupHash] {
+			status = "duplicate"
+			result.Duplicates++
+		} else {
+			seen[row.DedupHash] = true
+			result.WouldInsert++
+		}
+		if len(result.Sample) < dryRunSampleSize {
+			result.Sample = append(result.Sample, dryRunRow{
+				Line:        row.Line,
+				Date:        row.Date,
+				Description: row.Description,
+				Merchant:    normalizeMerchant(row.Description),
+				Amount:      row.Amount,
+				Type:        row.Type,
+				Category:    row.Category,
+				Status:      status,
+			})
+		}
+	}
+
+	c.JSON(http.StatusOK, result)
+}
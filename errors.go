@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Stable error codes returned in APIError.Code. Clients should branch on these
+// rather than on the human-readable message.
+const (
+	codeInvalidRequest   = "invalid_request"
+	codeUnauthorized     = "unauthorized"
+	codeNotFound         = "not_found"
+	codeConflict         = "conflict"
+	codeValidationFailed = "validation_failed"
+	codeRateLimited      = "rate_limited"
+	codeTimeout          = "timeout"
+	codeUnavailable      = "unavailable"
+	codeInternal         = "internal_error"
+)
+
+// APIError is the body of every error response, wrapped as {"error": APIError}.
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details any    `json:"details,omitempty"`
+}
+
+func respondError(c *gin.Context, status int, code, msg string) {
+	respondErrorDetails(c, status, code, msg, nil)
+}
+
+func respondErrorDetails(c *gin.Context, status int, code, msg string, details any) {
+	c.Writer.Header().Add("Vary", "Accept")
+	if acceptsProblemJSON(c.GetHeader("Accept")) {
+		c.Header("Content-Type", problemContentType+"; charset=utf-8")
+		c.AbortWithStatusJSON(status, Problem{
+			Type:     problemTypePrefix + code,
+			Title:    http.StatusText(status),
+			Status:   status,
+			Detail:   msg,
+			Instance: c.Request.URL.Path,
+			Code:     code,
+			Details:  details,
+		})
+		return
+	}
+	c.AbortWithStatusJSON(status, gin.H{"error": APIError{Code: code, Message: msg, Details: details}})
+}
+
+const (
+	problemContentType = "application/problem+json"
+	problemTypePrefix  = "urn:transaction-api:error:"
+)
+
+// Problem is an RFC 7807 error body, sent instead of APIError to clients that
+// ask for application/problem+json. Code and Details carry the same values
+// as in APIError, as extension members.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail"`
+	Instance string `json:"instance"`
+	Code     string `json:"code"`
+	Details  any    `json:"details,omitempty"`
+}
+
+// acceptsProblemJSON reports whether the Accept header names
+// application/problem+json with a non-zero quality. Wildcards don't count,
+// so existing clients keep the default format.
+func acceptsProblemJSON(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(mediaType), problemContentType) {
+			continue
+		}
+		for _, param := range strings.Split(params, ";") {
+			name, value, _ := strings.Cut(param, "=")
+			if strings.TrimSpace(name) == "q" {
+				if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && q == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// respondDBError translates a database error into a stable code and a
+// client-safe message. The raw driver error is only included outside of
+// release mode, to aid local debugging.
+func respondDBError(c *gin.Context, err error) {
+	status, code, msg := classifyDBError(err)
+
+	var details any
+	if gin.Mode() != gin.ReleaseMode {
+		details = err.Error()
+	}
+	respondErrorDetails(c, status, code, msg, details)
+}
+
+func classifyDBError(err error) (status int, code, msg string) {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return http.StatusNotFound, codeNotFound, "Resource not found"
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout, codeTimeout, "The database did not respond in time"
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case pgErr.Code == "23505":
+			return http.StatusConflict, codeConflict, "A conflicting record already exists"
+		case pgErr.Code == "23503":
+			return http.StatusBadRequest, codeInvalidRequest, "A referenced record does not exist"
+		case pgErr.Code == "22P02", pgErr.Code == "23514", pgErr.Code == "22003":
+			return http.StatusBadRequest, codeInvalidRequest, "Invalid input value"
+		case pgErr.Code == "2201B":
+			return http.StatusBadRequest, codeInvalidRequest, "Invalid regular expression"
+		case len(pgErr.Code) == 5 && pgErr.Code[:2] == "08":
+			return http.StatusServiceUnavailable, codeUnavailable, "The database is unavailable"
+		}
+	}
+
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) || pgconn.Timeout(err) {
+		return http.StatusServiceUnavailable, codeUnavailable, "The database is unavailable"
+	}
+
+	return http.StatusInternalServerError, codeInternal, "Internal server error"
+}
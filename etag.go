@@ -0,0 +1,55 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondJSONWithETag writes body as JSON with an ETag derived from its
+// content, or a bare 304 when the client's If-None-Match already has it.
+func respondJSONWithETag(c *gin.Context, body any) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		c.Error(err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Internal server error")
+		return
+	}
+	writeWithETag(c, contentETag(data), data)
+}
+
+// contentETag hashes a response body. The tag is weak because gzipResponse
+// may re-encode the bytes, which a strong tag would forbid.
+func contentETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `W/"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+func writeWithETag(c *gin.Context, etag string, data []byte) {
+	c.Header("ETag", etag)
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+}
+
+// etagMatches applies the weak comparison If-None-Match calls for, where
+// W/"x" and "x" are the same tag.
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"github.com/xuri/excelize/v2"
+)
+
+// exportTransactionsCSV streams every transaction matching the list filters
+// straight to the response, so large exports are never held in memory.
+func (api *API) exportTransactionsCSV(c *gin.Context) {
+	filter, err := api.parseTransactionFilter(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	orderBy, err := parseSort(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	// Exports can legitimately outlast the query timeout and the server's
+	// write timeout, so they are only bounded by the client staying connected
+	disableWriteTimeout(c)
+	rows, err := api.reader().Query(c.Request.Context(),
+		"SELECT "+transactionColumns+" FROM transactions"+filter.where()+" ORDER BY "+orderBy,
+		filter.args...)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", `attachment; filename="transactions.csv"`)
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write(csvHeader)
+	for rows.Next() {
+		var t Transaction
+		if err := scanTransaction(rows, &t); err != nil {
+			// Headers are already sent, so the best we can do is stop writing
+			c.Error(err)
+			break
+		}
+		w.Write(csvRecord(&t))
+	}
+	if err := rows.Err(); err != nil {
+		c.Error(err)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		c.Error(err)
+	}
+}
+
+// csvHeader names the columns csvRecord writes.
+var csvHeader = []string{"id", "date", "description", "amount", "type", "created_at"}
+
+func csvRecord(t *Transaction) []string {
+	return []string{
+		strconv.Itoa(t.ID),
+		t.Date.Format(time.RFC3339),
+		t.Description,
+		t.Amount.StringFixed(2),
+		t.Type,
+		t.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+const (
+	xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	xlsxSheet       = "Transactions"
+	xlsxMoneyFormat = `#,##0.00;[Red]-#,##0.00`
+)
+
+// exportTransactionsXLSX writes the transactions matching the list filters to
+// a spreadsheet. Amounts are signed, debits negative, so the totals row is a
+// plain SUM over the column.
+func (api *API) exportTransactionsXLSX(c *gin.Context) {
+	filter, err := api.parseTransactionFilter(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	orderBy, err := parseSort(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	rows, err := api.reader().Query(c.Request.Context(),
+		"SELECT "+transactionColumns+" FROM transactions"+filter.where()+" ORDER BY "+orderBy,
+		filter.args...)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	// The workbook is a zip archive and can't be streamed, so unlike the CSV
+	// export it is assembled before anything is sent and errors still get a
+	// proper response
+	f := excelize.NewFile()
+	defer f.Close()
+	f.SetSheetName(f.GetSheetName(0), xlsxSheet)
+
+	sw, err := f.NewStreamWriter(xlsxSheet)
+	if err != nil {
+		respondExportError(c, err)
+		return
+	}
+	styles, err := newXLSXStyles(f)
+	if err != nil {
+		respondExportError(c, err)
+		return
+	}
+
+	for col, width := range []float64{8, 12, 40, 24, 18, 10, 14} {
+		if err := sw.SetColWidth(col+1, col+1, width); err != nil {
+			respondExportError(c, err)
+			return
+		}
+	}
+	if err := sw.SetPanes(&excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"}); err != nil {
+		respondExportError(c, err)
+		return
+	}
+
+	header := []interface{}{}
+	for _, title := range []string{"ID", "Date", "Description", "Merchant", "Category", "Type", "Amount"} {
+		header = append(header, excelize.Cell{StyleID: styles.header, Value: title})
+	}
+	if err := sw.SetRow("A1", header); err != nil {
+		respondExportError(c, err)
+		return
+	}
+
+	row := 2
+	total := decimal.Zero
+	for rows.Next() {
+		var t Transaction
+		if err := scanTransaction(rows, &t); err != nil {
+			respondDBError(c, err)
+			return
+		}
+
+		amount := t.Amount
+		if t.Type == "debit" {
+			amount = amount.Neg()
+		}
+		total = total.Add(amount)
+
+		cell, _ := excelize.CoordinatesToCellName(1, row)
+		err := sw.SetRow(cell, []interface{}{
+			t.ID,
+			excelize.Cell{StyleID: styles.date, Value: t.Date},
+			t.Description,
+			stringOrEmpty(t.Merchant),
+			stringOrEmpty(t.Category),
+			t.Type,
+			excelize.Cell{StyleID: styles.money, Value: amount.InexactFloat64()},
+		})
+		if err != nil {
+			respondExportError(c, err)
+			return
+		}
+		row++
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	// The cached value lets viewers that don't recalculate show the total
+	cell, _ := excelize.CoordinatesToCellName(1, row)
+	err = sw.SetRow(cell, []interface{}{
+		excelize.Cell{StyleID: styles.header, Value: "Total"},
+		nil, nil, nil, nil, nil,
+		excelize.Cell{StyleID: styles.total, Formula: fmt.Sprintf("SUM(G2:G%d)", row-1), Value: total.InexactFloat64()},
+	})
+	if err != nil {
+		respondExportError(c, err)
+		return
+	}
+	if err := sw.Flush(); err != nil {
+		respondExportError(c, err)
+		return
+	}
+
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		respondExportError(c, err)
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="transactions.xlsx"`)
+	c.Data(http.StatusOK, xlsxContentType, buf.Bytes())
+}
+
+// xlsxStyles are the style IDs registered on an export workbook.
+type xlsxStyles struct {
+	header int
+	date   int
+	money  int
+	total  int
+}
+
+func newXLSXStyles(f *excelize.File) (xlsxStyles, error) {
+	var s xlsxStyles
+	var err error
+
+	moneyFormat := xlsxMoneyFormat
+	dateFormat := "yyyy-mm-dd"
+	bold := &excelize.Font{Bold: true}
+
+	if s.header, err = f.NewStyle(&excelize.Style{
+		Font: bold,
+		Fill: excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"#D9E1F2"}},
+	}); err != nil {
+		return s, err
+	}
+	if s.date, err = f.NewStyle(&excelize.Style{CustomNumFmt: &dateFormat}); err != nil {
+		return s, err
+	}
+	if s.money, err = f.NewStyle(&excelize.Style{CustomNumFmt: &moneyFormat}); err != nil {
+		return s, err
+	}
+	if s.total, err = f.NewStyle(&excelize.Style{
+		Font:         bold,
+		CustomNumFmt: &moneyFormat,
+		Border:       []excelize.Border{{Type: "top", Color: "#000000", Style: 1}},
+	}); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// respondExportError reports a failure building the workbook itself, keeping
+// the cause for the request log.
+func respondExportError(c *gin.Context, err error) {
+	c.Error(err)
+	respondError(c, http.StatusInternalServerError, codeInternal, "Unable to build spreadsheet")
+}
+
+func stringOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
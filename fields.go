@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// transactionFieldValues maps each JSON field of Transaction to its value, for
+// responses restricted with ?fields=.
+var transactionFieldValues = map[string]func(t *Transaction) any{
+	"id":          func(t *Transaction) any { return t.ID },
+	"date":        func(t *Transaction) any { return t.Date },
+	"description": func(t *Transaction) any { return t.Description },
+	"merchant":    func(t *Transaction) any { return t.Merchant },
+	"amount":      func(t *Transaction) any { return t.Amount },
+	"currency":    func(t *Transaction) any { return t.Currency },
+	"type":        func(t *Transaction) any { return t.Type },
+	"category":    func(t *Transaction) any { return t.Category },
+	"note":        func(t *Transaction) any { return t.Note },
+	"tags":        func(t *Transaction) any { return t.Tags },
+	"account_id":  func(t *Transaction) any { return t.AccountID },
+	"transfer_id": func(t *Transaction) any { return t.TransferID },
+	"job_id":      func(t *Transaction) any { return t.JobID },
+	"external_id": func(t *Transaction) any { return t.ExternalID },
+	"cleared":     func(t *Transaction) any { return t.Cleared },
+	"version":     func(t *Transaction) any { return t.Version },
+	"created_at":  func(t *Transaction) any { return t.CreatedAt },
+	"deleted_at":  func(t *Transaction) any { return t.DeletedAt },
+	"balance":     func(t *Transaction) any { return t.Balance },
+	"splits":      func(t *Transaction) any { return t.Splits },
+}
+
+// parseFields reads the comma-separated fields parameter. A nil result means
+// every field was asked for.
+func parseFields(c *gin.Context) ([]string, error) {
+	v := strings.TrimSpace(c.Query("fields"))
+	if v == "" {
+		return nil, nil
+	}
+
+	var fields []string
+	seen := make(map[string]bool)
+	for _, field := range strings.Split(v, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" || seen[field] {
+			continue
+		}
+		if _, ok := transactionFieldValues[field]; !ok {
+			return nil, fmt.Errorf("unknown field %q: must be one of %s", field, strings.Join(transactionFieldNames(), ", "))
+		}
+		seen[field] = true
+		fields = append(fields, field)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("fields must name at least one field")
+	}
+	return fields, nil
+}
+
+func transactionFieldNames() []string {
+	names := make([]string, 0, len(transactionFieldValues))
+	for name := range transactionFieldValues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sparseTransactions keeps only fields of each transaction.
+func sparseTransactions(transactions []Transaction, fields []string) []map[string]any {
+	sparse := make([]map[string]any, len(transactions))
+	for i := range transactions {
+		m := make(map[string]any, len(fields))
+		for _, field := range fields {
+			m[field] = transactionFieldValues[field](&transactions[i])
+		}
+		sparse[i] = m
+	}
+	return sparse
+}
@@ -0,0 +1,85 @@
+// Code generated by github.com/99designs/gqlgen, DO NOT EDIT.
+
+package graph
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type CurrencyTotals struct {
+	Currency          string          `json:"currency"`
+	TotalTransactions int             `json:"totalTransactions"`
+	TotalDebits       decimal.Decimal `json:"totalDebits"`
+	TotalCredits      decimal.Decimal `json:"totalCredits"`
+}
+
+type Job struct {
+	JobID          string    `json:"jobId"`
+	Status         string    `json:"status"`
+	Error          *string   `json:"error,omitempty"`
+	ProcessedCount *int      `json:"processedCount,omitempty"`
+	TotalCount     *int      `json:"totalCount,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+type Query struct {
+}
+
+type Stats struct {
+	TotalTransactions int              `json:"totalTransactions"`
+	BaseCurrency      string           `json:"baseCurrency"`
+	TotalDebits       decimal.Decimal  `json:"totalDebits"`
+	TotalCredits      decimal.Decimal  `json:"totalCredits"`
+	NetBalance        decimal.Decimal  `json:"netBalance"`
+	ClearedBalance    decimal.Decimal  `json:"clearedBalance"`
+	UnclearedBalance  decimal.Decimal  `json:"unclearedBalance"`
+	MissingRates      bool             `json:"missingRates"`
+	Unconverted       []CurrencyTotals `json:"unconverted"`
+	CachedAt          time.Time        `json:"cachedAt"`
+}
+
+type Transaction struct {
+	ID          int             `json:"id"`
+	Date        time.Time       `json:"date"`
+	Description string          `json:"description"`
+	Merchant    *string         `json:"merchant,omitempty"`
+	Amount      decimal.Decimal `json:"amount"`
+	Currency    string          `json:"currency"`
+	Type        string          `json:"type"`
+	Category    *string         `json:"category,omitempty"`
+	Note        *string         `json:"note,omitempty"`
+	Tags        []string        `json:"tags"`
+	AccountID   *int            `json:"accountId,omitempty"`
+	TransferID  *string         `json:"transferId,omitempty"`
+	JobID       *string         `json:"jobId,omitempty"`
+	ExternalID  *string         `json:"externalId,omitempty"`
+	Cleared     bool            `json:"cleared"`
+	Version     int             `json:"version"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	DeletedAt   *time.Time      `json:"deletedAt,omitempty"`
+}
+
+// Narrows a transaction list. Fields match the REST list endpoint's query parameters.
+type TransactionFilter struct {
+	From           *string          `json:"from,omitempty"`
+	To             *string          `json:"to,omitempty"`
+	Type           *string          `json:"type,omitempty"`
+	Category       *string          `json:"category,omitempty"`
+	AccountID      *int             `json:"accountId,omitempty"`
+	Cleared        *bool            `json:"cleared,omitempty"`
+	MinAmount      *decimal.Decimal `json:"minAmount,omitempty"`
+	MaxAmount      *decimal.Decimal `json:"maxAmount,omitempty"`
+	Q              *string          `json:"q,omitempty"`
+	Similar        *string          `json:"similar,omitempty"`
+	Tags           []string         `json:"tags,omitempty"`
+	IncludeDeleted *bool            `json:"includeDeleted,omitempty"`
+}
+
+type TransactionPage struct {
+	Total        int           `json:"total"`
+	Limit        int           `json:"limit"`
+	Offset       int           `json:"offset"`
+	Transactions []Transaction `json:"transactions"`
+}
@@ -0,0 +1,40 @@
+// Package graph holds the GraphQL executor and models generated from
+// schema.graphql. Run go generate in the repository root after editing the
+// schema.
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/shopspring/decimal"
+)
+
+// MarshalDecimal writes a Decimal scalar as a JSON number, as the REST
+// endpoints do.
+func MarshalDecimal(d decimal.Decimal) graphql.Marshaler {
+	return graphql.WriterFunc(func(w io.Writer) {
+		io.WriteString(w, d.String())
+	})
+}
+
+// UnmarshalDecimal reads a Decimal scalar given as a number or a string.
+func UnmarshalDecimal(v any) (decimal.Decimal, error) {
+	switch v := v.(type) {
+	case string:
+		return decimal.NewFromString(v)
+	case json.Number:
+		return decimal.NewFromString(v.String())
+	case int:
+		return decimal.NewFromInt(int64(v)), nil
+	case int64:
+		return decimal.NewFromInt(v), nil
+	case float64:
+		return decimal.NewFromString(strconv.FormatFloat(v, 'f', -1, 64))
+	default:
+		return decimal.Decimal{}, fmt.Errorf("%T is not a decimal", v)
+	}
+}
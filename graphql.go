@@ -0,0 +1,252 @@
+package main
+
+//go:generate go run github.com/99designs/gqlgen generate
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jupark12/transaction-api/graph"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// graphQLUserKey carries the authenticated user from the gin handler into
+// the resolvers, which only see a context.Context.
+type graphQLUserKey struct{}
+
+// graphQLHandler serves graph/schema.graphql over GET and POST. Resolvers answer
+// through the same parsers and queries as the REST endpoints.
+func (api *API) graphQLHandler() gin.HandlerFunc {
+	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: &graphQLResolver{api: api}}))
+	srv.AddTransport(transport.GET{})
+	srv.AddTransport(transport.POST{})
+	srv.Use(extension.Introspection{})
+
+	return func(c *gin.Context) {
+		ctx := context.WithValue(c.Request.Context(), graphQLUserKey{}, currentUserID(c))
+		srv.ServeHTTP(c.Writer, c.Request.WithContext(ctx))
+	}
+}
+
+type graphQLResolver struct {
+	api *API
+}
+
+func (r *graphQLResolver) Query() graph.QueryResolver {
+	return r
+}
+
+func (r *graphQLResolver) Transactions(ctx context.Context, filter *graph.TransactionFilter, limit, offset *int, sort, order *string) (*graph.TransactionPage, error) {
+	params := graphQLFilterParams(filter)
+	setIntParam(params, "limit", limit)
+	setIntParam(params, "offset", offset)
+	setParam(params, "sort", sort)
+	setParam(params, "order", order)
+	c := paramsContext(graphQLUserID(ctx), params)
+
+	pageLimit, pageOffset, err := r.api.parsePagination(c)
+	if err != nil {
+		return nil, graphQLInputError(err)
+	}
+	f, err := r.api.parseTransactionFilter(c)
+	if err != nil {
+		return nil, graphQLInputError(err)
+	}
+	orderBy, err := parseSort(c)
+	if err != nil {
+		return nil, graphQLInputError(err)
+	}
+	// Closest matches come first unless the caller picked a sort
+	if rank := f.similarityRank(); rank != "" && sort == nil {
+		orderBy = rank + ", " + orderBy
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.api.queryTimeout)
+	defer cancel()
+
+	db := r.api.reader()
+	total, err := countMatching(ctx, db, f)
+	if err != nil {
+		return nil, graphQLDBError(err)
+	}
+	transactions, err := listTransactions(ctx, db, f, orderBy, pageLimit, pageOffset, false)
+	if err != nil {
+		return nil, graphQLDBError(err)
+	}
+	page := &graph.TransactionPage{Total: total, Limit: pageLimit, Offset: pageOffset, Transactions: make([]graph.Transaction, len(transactions))}
+	for i, t := range transactions {
+		page.Transactions[i] = graphQLTransaction(t)
+	}
+	return page, nil
+}
+
+func (r *graphQLResolver) Transaction(ctx context.Context, id int, includeDeleted *bool) (*graph.Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.api.queryTimeout)
+	defer cancel()
+
+	t, err := r.api.findTransaction(ctx, graphQLUserID(ctx), strconv.Itoa(id), includeDeleted != nil && *includeDeleted)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, graphQLDBError(err)
+	}
+	gt := graphQLTransaction(t)
+	return &gt, nil
+}
+
+func (r *graphQLResolver) Stats(ctx context.Context, from, to *string, accountID *int) (*graph.Stats, error) {
+	params := url.Values{}
+	setParam(params, "from", from)
+	setParam(params, "to", to)
+	setIntParam(params, "account_id", accountID)
+	filter, err := parseStatsFilter(paramsContext(graphQLUserID(ctx), params))
+	if err != nil {
+		return nil, graphQLInputError(err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.api.queryTimeout)
+	defer cancel()
+
+	stats, err := r.api.loadStats(ctx, r.api.reader(), graphQLUserID(ctx), filter)
+	if err != nil {
+		return nil, graphQLDBError(err)
+	}
+	gs := &graph.Stats{
+		TotalTransactions: stats.TotalTransactions,
+		BaseCurrency:      stats.BaseCurrency,
+		TotalDebits:       stats.TotalDebits,
+		TotalCredits:      stats.TotalCredits,
+		NetBalance:        stats.NetBalance,
+		ClearedBalance:    stats.ClearedBalance,
+		UnclearedBalance:  stats.UnclearedBalance,
+		MissingRates:      stats.MissingRates,
+		Unconverted:       make([]graph.CurrencyTotals, len(stats.Unconverted)),
+		CachedAt:          stats.CachedAt,
+	}
+	for i, totals := range stats.Unconverted {
+		gs.Unconverted[i] = graph.CurrencyTotals(totals)
+	}
+	return gs, nil
+}
+
+func (r *graphQLResolver) Jobs(ctx context.Context, status *string) ([]graph.Job, error) {
+	filter := userFilter(paramsContext(graphQLUserID(ctx), nil))
+	if status != nil && *status != "" {
+		filter.add("status = $%d", *status)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.api.queryTimeout)
+	defer cancel()
+
+	jobs, err := r.api.listJobs(ctx, filter)
+	if err != nil {
+		return nil, graphQLDBError(err)
+	}
+	gjobs := make([]graph.Job, len(jobs))
+	for i, j := range jobs {
+		gjobs[i] = graph.Job{
+			JobID:          j.JobID,
+			Status:         j.Status,
+			Error:          j.Error,
+			ProcessedCount: j.ProcessedCount,
+			TotalCount:     j.TotalCount,
+			CreatedAt:      j.CreatedAt,
+		}
+	}
+	return gjobs, nil
+}
+
+// graphQLTransaction copies t into its GraphQL model, which leaves out the
+// list-only balance and splits.
+func graphQLTransaction(t Transaction) graph.Transaction {
+	return graph.Transaction{
+		ID:          t.ID,
+		Date:        t.Date,
+		Description: t.Description,
+		Merchant:    t.Merchant,
+		Amount:      t.Amount,
+		Currency:    t.Currency,
+		Type:        t.Type,
+		Category:    t.Category,
+		Note:        t.Note,
+		Tags:        t.Tags,
+		AccountID:   t.AccountID,
+		TransferID:  t.TransferID,
+		JobID:       t.JobID,
+		ExternalID:  t.ExternalID,
+		Cleared:     t.Cleared,
+		Version:     t.Version,
+		CreatedAt:   t.CreatedAt,
+		DeletedAt:   t.DeletedAt,
+	}
+}
+
+// graphQLFilterParams converts f to the list endpoint's query parameters, so
+// parseTransactionFilter applies it exactly as it would over REST.
+func graphQLFilterParams(f *graph.TransactionFilter) url.Values {
+	params := url.Values{}
+	if f == nil {
+		return params
+	}
+	setParam(params, "from", f.From)
+	setParam(params, "to", f.To)
+	setParam(params, "type", f.Type)
+	setParam(params, "category", f.Category)
+	setIntParam(params, "account_id", f.AccountID)
+	if f.Cleared != nil {
+		params.Set("cleared", strconv.FormatBool(*f.Cleared))
+	}
+	if f.MinAmount != nil {
+		params.Set("min_amount", f.MinAmount.String())
+	}
+	if f.MaxAmount != nil {
+		params.Set("max_amount", f.MaxAmount.String())
+	}
+	setParam(params, "q", f.Q)
+	setParam(params, "similar", f.Similar)
+	for _, tag := range f.Tags {
+		params.Add("tag", tag)
+	}
+	if f.IncludeDeleted != nil {
+		params.Set("include_deleted", strconv.FormatBool(*f.IncludeDeleted))
+	}
+	return params
+}
+
+func setParam(params url.Values, name string, v *string) {
+	if v != nil {
+		params.Set(name, *v)
+	}
+}
+
+func setIntParam(params url.Values, name string, v *int) {
+	if v != nil {
+		params.Set(name, strconv.Itoa(*v))
+	}
+}
+
+func graphQLUserID(ctx context.Context) string {
+	userID, _ := ctx.Value(graphQLUserKey{}).(string)
+	return userID
+}
+
+// graphQLInputError reports an invalid argument with the code a REST 400
+// would carry.
+func graphQLInputError(err error) error {
+	return &gqlerror.Error{Message: err.Error(), Extensions: map[string]any{"code": codeInvalidRequest}}
+}
+
+// graphQLDBError reports a database error with the client-safe message and
+// code respondDBError would use.
+func graphQLDBError(err error) error {
+	_, code, msg := classifyDBError(err)
+	return &gqlerror.Error{Message: msg, Extensions: map[string]any{"code": code}}
+}
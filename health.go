@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readinessTimeout bounds the database ping so a hung database fails the
+// probe instead of hanging it.
+const readinessTimeout = 2 * time.Second
+
+func (api *API) health(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func (api *API) ready(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	if err := api.db.Ping(ctx); err != nil {
+		respondError(c, http.StatusServiceUnavailable, codeUnavailable, "Database is unreachable")
+		return
+	}
+	if api.replica != nil {
+		if err := api.replica.Ping(ctx); err != nil {
+			respondError(c, http.StatusServiceUnavailable, codeUnavailable, "Read replica is unreachable")
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	idempotencyKeyHeader    = "Idempotency-Key"
+	idempotencyKeyTTL       = 24 * time.Hour
+	maxIdempotencyKeyLength = 255
+)
+
+// createTransactionIdempotently inserts t unless the user already sent key
+// within idempotencyKeyTTL, in which case the original transaction is
+// returned. Reusing a key with a different body is rejected with 409.
+func (api *API) createTransactionIdempotently(ctx context.Context, c *gin.Context, key string, body []byte, t *Transaction) {
+	if len(key) > maxIdempotencyKeyLength {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest,
+			fmt.Sprintf("%s must be at most %d characters", idempotencyKeyHeader, maxIdempotencyKeyLength))
+		return
+	}
+	sum := sha256.Sum256(body)
+	requestHash := hex.EncodeToString(sum[:])
+	userID := currentUserID(c)
+
+	// Expired keys are purged lazily so they can be reused once the TTL passes
+	_, err := api.db.Exec(ctx, "DELETE FROM idempotency_keys WHERE created_at < $1", time.Now().Add(-idempotencyKeyTTL))
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	tx, err := api.db.Begin(ctx)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var storedHash string
+	var transactionID int
+	err = tx.QueryRow(ctx,
+		"SELECT request_hash, transaction_id FROM idempotency_keys WHERE user_id = $1 AND key = $2",
+		userID, key).Scan(&storedHash, &transactionID)
+	switch {
+	case err == nil:
+		if storedHash != requestHash {
+			respondError(c, http.StatusConflict, codeConflict,
+				idempotencyKeyHeader+" was already used with a different request body")
+			return
+		}
+		err = scanTransaction(tx.QueryRow(ctx,
+			"SELECT "+transactionColumns+" FROM transactions WHERE id = $1", transactionID), t)
+		if err != nil {
+			respondDBError(c, err)
+			return
+		}
+		c.Header("Idempotent-Replayed", "true")
+		c.JSON(http.StatusCreated, t)
+		return
+	case !errors.Is(err, pgx.ErrNoRows):
+		respondDBError(c, err)
+		return
+	}
+
+	if err := insertTransaction(ctx, tx, userID, t); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	// A concurrent request with the same key fails here on the primary key
+	// and is reported as a conflict
+	_, err = tx.Exec(ctx,
+		"INSERT INTO idempotency_keys (user_id, key, request_hash, transaction_id) VALUES ($1, $2, $3, $4)",
+		userID, key, requestHash, t.ID)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	api.notifyWebhooks(userID, eventTransactionCreated, t.ID)
+
+	c.JSON(http.StatusCreated, t)
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+// requiredImportColumns are the fields every CSV import must have a column
+// for. Without a type column the type comes from the amount's sign.
+var requiredImportColumns = []string{"date", "description", "amount"}
+
+// Supported import file formats, selected with ?format= or detected from the
+// start of the file.
+const (
+	importFormatCSV = "csv"
+	importFormatOFX = "ofx"
+	importFormatQIF = "qif"
+)
+
+// importSniffLength is how much of an upload is inspected to detect its format.
+const importSniffLength = 1024
+
+// importRow is a parsed statement line along with the hash used to recognise
+// it on later imports. Line is its position in the source file, or 0 when the
+// format has no meaningful line numbers.
+type importRow struct {
+	Transaction
+	DedupHash string
+	Line      int
+}
+
+// importTransactions parses an uploaded statement and queues it for import.
+// With dry_run=true it only reports what the import would do.
+func (api *API) importTransactions(c *gin.Context) {
+	dryRun := false
+	if v := c.Query("dry_run"); v != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("invalid dry_run %q", v))
+			return
+		}
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		respondUploadError(c, err, "A file upload named \"file\" is required")
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	defer f.Close()
+
+	br := bufio.NewReaderSize(f, importSniffLength)
+	format, err := importFormat(c.Query("format"), br)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	dates, err := api.importDateLayouts(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	csvOpts, err := parseCSVImportOptions(c, dates)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	var rows []importRow
+	var invalid []importRowError
+	switch format {
+	case importFormatOFX:
+		rows, invalid, err = parseOFX(br)
+	case importFormatQIF:
+		rows, invalid, err = parseQIF(br, dates)
+	default:
+		rows, invalid, err = parseCSVImport(br, csvOpts)
+	}
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	rows, invalid = dropFutureRows(rows, invalid, api.maxFutureDays)
+
+	if dryRun {
+		api.respondImportDryRun(c, format, rows, invalid)
+		return
+	}
+
+	// The file is parsed up front so format errors are reported immediately;
+	// only the inserts are left to the worker
+	api.queueImport(c, func() ([]importRow, []importRowError, error) { return rows, invalid, nil })
+}
+
+// queueImport creates a job for the current user and hands extract to the
+// worker pool, responding 202 with the queued job.
+func (api *API) queueImport(c *gin.Context, extract func() ([]importRow, []importRowError, error)) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	userID := currentUserID(c)
+	job, err := api.createJob(ctx, userID)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	if err := api.enqueue(importTask{jobID: job.JobID, userID: userID, extract: extract}); err != nil {
+		api.failJob(job.JobID, err.Error())
+		respondErrorDetails(c, http.StatusServiceUnavailable, codeUnavailable,
+			"Too many imports in progress, try again later", gin.H{"job_id": job.JobID})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// respondUploadError reports a missing or unreadable "file" form field with
+// msg, unless the upload was cut off for being too large.
+func respondUploadError(c *gin.Context, err error, msg string) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondBodyError(c, err)
+		return
+	}
+	respondError(c, http.StatusBadRequest, codeInvalidRequest, msg)
+}
+
+// insertImportRow stores one imported row under jobID, deriving its merchant
+// from the raw description. It reports false when the row was already
+// imported for this user, via the dedup_hash index.
+func (api *API) insertImportRow(ctx context.Context, jobID, userID string, row importRow) (bool, error) {
+	tag, err := api.db.Exec(ctx,
+		"INSERT INTO transactions (date, description, merchant, amount, type, category, job_id, user_id, dedup_hash) "+
+			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) "+
+			"ON CONFLICT (user_id, dedup_hash) WHERE deleted_at IS NULL DO NOTHING",
+		row.Date, row.Description, normalizeMerchant(row.Description), row.Amount, row.Type, row.Category,
+		jobID, userID, row.DedupHash)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// importFormat resolves the requested format, detecting it from the start of
+// the file when none is given.
+func importFormat(requested string, br *bufio.Reader) (string, error) {
+	switch strings.ToLower(requested) {
+	case importFormatCSV:
+		return importFormatCSV, nil
+	case importFormatOFX, "qfx":
+		return importFormatOFX, nil
+	case importFormatQIF:
+		return importFormatQIF, nil
+	case "":
+	default:
+		return "", fmt.Errorf("invalid format %q: must be csv, ofx or qif", requested)
+	}
+
+	// Peek returns what it could read along with any error, which is fine here
+	head, _ := br.Peek(importSniffLength)
+	s := strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(string(head), "\ufeff")))
+	switch {
+	case strings.HasPrefix(s, "OFXHEADER"), strings.Contains(s, "<OFX>"):
+		return importFormatOFX, nil
+	case strings.HasPrefix(s, "!TYPE:"), strings.HasPrefix(s, "!OPTION:"), strings.HasPrefix(s, "!ACCOUNT"):
+		return importFormatQIF, nil
+	}
+	return importFormatCSV, nil
+}
+
+// parseCSVImport reads a CSV file with a header row, finding its columns
+// through opts. Invalid rows are reported rather than failing the whole
+// import.
+func parseCSVImport(r io.Reader, opts csvImportOptions) (rows []importRow, invalid []importRowError, err error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, errors.New("unable to read CSV header")
+	}
+	columns, err := resolveImportColumns(header, opts.Mapping)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// Malformed lines are skipped like any other invalid row
+			var perr *csv.ParseError
+			if errors.As(err, &perr) {
+				invalid = append(invalid, importRowError{Line: perr.StartLine, Message: perr.Err.Error()})
+			} else {
+				invalid = append(invalid, importRowError{Message: err.Error()})
+			}
+			continue
+		}
+
+		line, _ := reader.FieldPos(0)
+		t, err := parseImportRecord(columns, record, opts)
+		if err != nil {
+			invalid = append(invalid, newImportRowError(line, err))
+			continue
+		}
+		rows = append(rows, importRow{Transaction: t, DedupHash: dedupHash(t), Line: line})
+	}
+	return rows, invalid, nil
+}
+
+// parseImportRecord builds a transaction from one CSV record, reading its
+// date with the first of opts.Dates that fits. When the file has no type
+// column the amount is signed, and opts.NegativeType says which type its
+// negative amounts are.
+func parseImportRecord(columns map[string]int, record []string, opts csvImportOptions) (Transaction, error) {
+	field := func(name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var t Transaction
+	var err error
+	if t.Date, err = opts.Dates.parse(field("date")); err != nil {
+		return t, err
+	}
+
+	t.Description = field("description")
+	if t.Description == "" {
+		return t, errors.New("description is required")
+	}
+
+	t.Amount, err = decimal.NewFromString(field("amount"))
+	if err != nil {
+		return t, &importValueError{Field: "amount", Value: field("amount")}
+	}
+
+	if _, ok := columns["type"]; !ok {
+		t.Type = oppositeType(opts.NegativeType)
+		if t.Amount.IsNegative() {
+			t.Type = opts.NegativeType
+		}
+		t.Amount = t.Amount.Abs()
+	} else {
+		t.Type = strings.ToLower(field("type"))
+		if !validTransactionTypes[t.Type] {
+			return t, &importValueError{Field: "type", Value: field("type")}
+		}
+	}
+
+	if category := field("category"); category != "" {
+		t.Category = &category
+	}
+	return t, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultImportDateFormats are tried in order on statement dates when
+// IMPORT_DATE_FORMATS is unset. Slashed dates are read month first, as US
+// banks and Quicken write them; dashed and dotted ones day first.
+var defaultImportDateFormats = []string{"YYYY-MM-DD", "M/D/YYYY", "M/D/YY", "D-M-YYYY", "D.M.YYYY", "YYYY/M/D"}
+
+// maxImportRowErrors caps how many invalid rows an import reports back.
+const maxImportRowErrors = 100
+
+// dateLayouts is an ordered list of Go time layouts for statement dates.
+type dateLayouts []string
+
+// parse returns the first reading of s that one of the layouts accepts. An
+// RFC3339 timestamp is always accepted.
+func (l dateLayouts) parse(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range l {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, &importValueError{Field: "date", Value: s}
+}
+
+// parseImportDateFormats reads IMPORT_DATE_FORMATS, a comma-separated list
+// of formats such as DD/MM/YYYY, falling back to defaultImportDateFormats
+// when it is unset or invalid.
+func parseImportDateFormats(v string) []string {
+	if strings.TrimSpace(v) == "" {
+		return defaultImportDateFormats
+	}
+	formats := strings.Split(v, ",")
+	if _, err := dateFormatLayouts(formats); err != nil {
+		log.Printf("Ignoring invalid IMPORT_DATE_FORMATS %q: %v\n", v, err)
+		return defaultImportDateFormats
+	}
+	return formats
+}
+
+func dateFormatLayouts(formats []string) (dateLayouts, error) {
+	layouts := make(dateLayouts, 0, len(formats))
+	for _, format := range formats {
+		layout, err := dateFormatLayout(strings.TrimSpace(format))
+		if err != nil {
+			return nil, err
+		}
+		layouts = append(layouts, layout)
+	}
+	return layouts, nil
+}
+
+// importDateLayouts returns the layouts an upload's dates are read with: the
+// request's date_format alone when given, otherwise the configured list.
+func (api *API) importDateLayouts(c *gin.Context) (dateLayouts, error) {
+	v := importOption(c, "date_format")
+	if v == "" {
+		return api.importDates, nil
+	}
+	layout, err := dateFormatLayout(v)
+	if err != nil {
+		return nil, err
+	}
+	return dateLayouts{layout}, nil
+}
+
+// importValueError is a statement field whose raw value couldn't be parsed.
+type importValueError struct {
+	Field string
+	Value string
+}
+
+func (e *importValueError) Error() string {
+	return fmt.Sprintf("invalid %s %q", e.Field, e.Value)
+}
+
+// importRowError describes a statement row that was skipped, by its line in
+// the file when the format has one.
+type importRowError struct {
+	Line    int    `json:"line,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Value   string `json:"value,omitempty"`
+	Message string `json:"message"`
+}
+
+func newImportRowError(line int, err error) importRowError {
+	e := importRowError{Line: line, Message: err.Error()}
+	var verr *importValueError
+	if errors.As(err, &verr) {
+		e.Field, e.Value = verr.Field, verr.Value
+	}
+	return e
+}
+
+// dropFutureRows moves rows dated more than maxFutureDays ahead into invalid,
+// so a garbage date in a file can't skew reports.
+func dropFutureRows(rows []importRow, invalid []importRowError, maxFutureDays int) ([]importRow, []importRowError) {
+	kept := rows[:0]
+	for _, row := range rows {
+		if tooFarInFuture(row.Date, maxFutureDays) {
+			invalid = append(invalid, importRowError{
+				Line:    row.Line,
+				Field:   "date",
+				Value:   row.Date.Format(time.DateOnly),
+				Message: "date " + futureDateMessage(maxFutureDays),
+			})
+			continue
+		}
+		kept = append(kept, row)
+	}
+	return kept, invalid
+}
+
+// reportedRowErrors trims errs to what an import reports back.
+func reportedRowErrors(errs []importRowError) []importRowError {
+	if len(errs) > maxImportRowErrors {
+		return errs[:maxImportRowErrors]
+	}
+	return errs
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+const jobColumns = "job_id, status, error, processed_count, total_count, row_errors, created_at"
+
+func scanJob(row pgx.Row, j *Job) error {
+	return row.Scan(&j.JobID, &j.Status, &j.Error, &j.ProcessedCount, &j.TotalCount, &j.RowErrors, &j.CreatedAt)
+}
+
+func (api *API) getJobs(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	filter := userFilter(c)
+	if v := c.Query("status"); v != "" {
+		filter.add("status = $%d", v)
+	}
+
+	jobs, err := api.listJobs(ctx, filter)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, jobs)
+}
+
+// listJobs reads the jobs matching filter, newest first.
+func (api *API) listJobs(ctx context.Context, filter *transactionFilter) ([]Job, error) {
+	rows, err := api.db.Query(ctx,
+		"SELECT "+jobColumns+" FROM jobs"+filter.where()+" ORDER BY created_at DESC",
+		filter.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		var j Job
+		if err := scanJob(rows, &j); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// headJob answers whether a job exists without reading or serializing it.
+func (api *API) headJob(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	var exists bool
+	err := withRetry(ctx, func() error {
+		return api.db.QueryRow(ctx,
+			"SELECT EXISTS (SELECT 1 FROM jobs WHERE job_id = $1 AND user_id = $2)", c.Param("id"), currentUserID(c)).
+			Scan(&exists)
+	})
+	respondExists(c, exists, err)
+}
+
+func (api *API) getJob(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	id := c.Param("id")
+	job := struct {
+		Job
+		TransactionCount int `json:"transaction_count"`
+	}{}
+
+	err := withRetry(ctx, func() error {
+		return scanJob(api.db.QueryRow(ctx,
+			"SELECT "+jobColumns+" FROM jobs WHERE job_id = $1 AND user_id = $2", id, currentUserID(c)), &job.Job)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		respondError(c, http.StatusNotFound, codeNotFound, "Job not found")
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	err = withRetry(ctx, func() error {
+		return api.db.QueryRow(ctx,
+			"SELECT COUNT(*) FROM transactions WHERE job_id = $1 AND user_id = $2 AND deleted_at IS NULL", id, currentUserID(c)).
+			Scan(&job.TransactionCount)
+	})
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// cancelJob stops a queued or running import. Rows inserted before the cancel
+// are kept; DELETE /jobs/most-recent or a bulk delete removes them.
+func (api *API) cancelJob(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	id := c.Param("id")
+	var job Job
+	err := scanJob(api.db.QueryRow(ctx,
+		"UPDATE jobs SET status = 'cancelled' WHERE job_id = $1 AND user_id = $2 AND status IN ('queued', 'processing') "+
+			"RETURNING "+jobColumns,
+		id, currentUserID(c)), &job)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Either the job doesn't exist or it has already finished
+		var status string
+		err = api.db.QueryRow(ctx,
+			"SELECT status FROM jobs WHERE job_id = $1 AND user_id = $2", id, currentUserID(c)).Scan(&status)
+		if errors.Is(err, pgx.ErrNoRows) {
+			respondError(c, http.StatusNotFound, codeNotFound, "Job not found")
+			return
+		}
+		if err != nil {
+			respondDBError(c, err)
+			return
+		}
+		respondError(c, http.StatusConflict, codeConflict, "Job is already "+status)
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	api.workers.cancelJob(id)
+
+	c.JSON(http.StatusOK, job)
+}
+
+// restoreJob undoes a job-wide soft delete such as deleteMostRecentJob.
+func (api *API) restoreJob(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	id := c.Param("id")
+	result, err := api.db.Exec(ctx,
+		"UPDATE transactions SET deleted_at = NULL WHERE job_id = $1 AND user_id = $2 AND deleted_at IS NOT NULL",
+		id, currentUserID(c))
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	if result.RowsAffected() == 0 {
+		respondError(c, http.StatusNotFound, codeNotFound, "No deleted transactions found for job")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"restored": result.RowsAffected()})
+}
+
+// createJob records a new queued job owned by userID.
+func (api *API) createJob(ctx context.Context, userID string) (Job, error) {
+	var j Job
+	err := scanJob(api.db.QueryRow(ctx,
+		"INSERT INTO jobs (job_id, status, user_id) VALUES (gen_random_uuid()::text, 'queued', $1) RETURNING "+jobColumns,
+		userID), &j)
+	return j, err
+}
+
+// setJobStatus records a job's status outside of any request context, so the
+// update still lands when the client that started the job has gone away.
+func (api *API) setJobStatus(jobID, status string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), api.queryTimeout)
+	defer cancel()
+
+	// A cancelled job keeps that status even if its worker finishes afterwards
+	_, err := api.db.Exec(ctx, "UPDATE jobs SET status = $1 WHERE job_id = $2 AND status <> 'cancelled'", status, jobID)
+	return err
+}
+
+// startJob moves a queued job to processing, reporting false when the job
+// was cancelled before a worker picked it up.
+func (api *API) startJob(jobID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), api.queryTimeout)
+	defer cancel()
+
+	tag, err := api.db.Exec(ctx, "UPDATE jobs SET status = 'processing' WHERE job_id = $1 AND status = 'queued'", jobID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// failJob marks a job failed with a message explaining why, using the same
+// detached context as setJobStatus.
+func (api *API) failJob(jobID, msg string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), api.queryTimeout)
+	defer cancel()
+
+	_, err := api.db.Exec(ctx,
+		"UPDATE jobs SET status = 'failed', error = $1 WHERE job_id = $2 AND status <> 'cancelled'", msg, jobID)
+	return err
+}
+
+// setJobRowErrors records the rows a job skipped as invalid, keeping the first
+// maxImportRowErrors of them.
+func (api *API) setJobRowErrors(jobID string, rowErrors []importRowError) error {
+	ctx, cancel := context.WithTimeout(context.Background(), api.queryTimeout)
+	defer cancel()
+
+	_, err := api.db.Exec(ctx,
+		"UPDATE jobs SET row_errors = $1 WHERE job_id = $2", reportedRowErrors(rowErrors), jobID)
+	return err
+}
+
+// setJobProgress records how many of a job's rows have been handled so far.
+func (api *API) setJobProgress(jobID string, processed, total int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), api.queryTimeout)
+	defer cancel()
+
+	_, err := api.db.Exec(ctx,
+		"UPDATE jobs SET processed_count = $1, total_count = $2 WHERE job_id = $3", processed, total, jobID)
+	return err
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultMaxBodySize   = 1 << 20
+	defaultMaxUploadSize = 32 << 20
+
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultReadTimeout       = time.Minute
+	defaultWriteTimeout      = time.Minute
+	defaultIdleTimeout       = 2 * time.Minute
+)
+
+// bodyLimit returns the most a request to route may send. File uploads and
+// bulk loads get more room than ordinary JSON bodies.
+func (api *API) bodyLimit(route string) int64 {
+	switch route {
+	case "/transactions/import", "/transactions/import/pdf", "/transactions/:id/attachments":
+		return api.maxUploadSize
+	case "/transactions/bulk":
+		return maxBulkBodySize
+	default:
+		return api.maxBodySize
+	}
+}
+
+// limitBody caps request bodies on mutating routes. Declared lengths over the
+// limit are refused up front; anything else is cut off by MaxBytesReader
+// once it reads past the limit, which respondBodyError reports as 413.
+func (api *API) limitBody(c *gin.Context) {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		c.Next()
+		return
+	}
+
+	limit := api.bodyLimit(c.FullPath())
+	if c.Request.ContentLength > limit {
+		respondTooLarge(c, limit)
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+	c.Next()
+}
+
+// respondBodyError reports a failure reading the request body, telling a
+// body cut off by limitBody apart from a malformed one.
+func respondBodyError(c *gin.Context, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondTooLarge(c, tooLarge.Limit)
+		return
+	}
+	respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+}
+
+func respondTooLarge(c *gin.Context, limit int64) {
+	respondError(c, http.StatusRequestEntityTooLarge, codeInvalidRequest,
+		fmt.Sprintf("Request body must be at most %s", formatBytes(limit)))
+}
+
+// formatBytes renders a size limit for error messages, e.g. "1 MB".
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprintf("%d MB", n>>20)
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return fmt.Sprintf("%d KB", n>>10)
+	default:
+		return fmt.Sprintf("%d bytes", n)
+	}
+}
+
+// disableWriteTimeout lifts the server's WriteTimeout for a response that
+// legitimately runs long, such as an event stream or a streamed export.
+func disableWriteTimeout(c *gin.Context) {
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		c.Error(err)
+	}
+}
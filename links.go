@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setPaginationLinks writes an RFC 8288 Link header for a page of the list
+// endpoint. Offset pages get first, prev, next and last; cursor pages can't
+// jump backwards or to the end, so they only get first and next. The targets
+// are relative to the request and keep its other parameters.
+func setPaginationLinks(c *gin.Context, limit, offset, total int, cursor bool, nextCursor *string) {
+	if limit <= 0 {
+		return
+	}
+
+	var links []string
+	link := func(rel string, set map[string]string) {
+		query := c.Request.URL.Query()
+		query.Del("offset")
+		query.Del("cursor")
+		for k, v := range set {
+			query.Set(k, v)
+		}
+		target := url.URL{Path: c.Request.URL.Path, RawQuery: query.Encode()}
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, target.String(), rel))
+	}
+
+	link("first", nil)
+	if cursor {
+		if nextCursor != nil {
+			link("next", map[string]string{"cursor": *nextCursor})
+		}
+	} else {
+		if offset > 0 {
+			link("prev", map[string]string{"offset": strconv.Itoa(max(offset-limit, 0))})
+		}
+		if offset+limit < total {
+			link("next", map[string]string{"offset": strconv.Itoa(offset + limit)})
+		}
+		last := 0
+		if total > 0 {
+			last = (total - 1) / limit * limit
+		}
+		link("last", map[string]string{"offset": strconv.Itoa(last)})
+	}
+
+	c.Header("Link", strings.Join(links, ", "))
+}
@@ -2,185 +2,1530 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/shopspring/decimal"
 )
 
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+	shutdownTimeout  = 10 * time.Second
+	maxBulkDeleteIDs = 1000
+
+	// defaultQueryTimeout bounds a request's database work when QUERY_TIMEOUT is unset
+	defaultQueryTimeout = 5 * time.Second
+)
+
+var validTransactionTypes = map[string]bool{
+	"debit":  true,
+	"credit": true,
+}
+
+// Amounts are stored as NUMERIC(14,2) and handled as decimal.Decimal so sums
+// are exact. They are serialized as bare JSON numbers (e.g. 12.34) rather than
+// quoted strings, keeping the wire format unchanged for existing clients.
+func init() {
+	decimal.MarshalJSONWithoutQuotes = true
+}
+
 type Transaction struct {
-	ID          int       `json:"id"`
-	Date        time.Time `json:"date"`
-	Description string    `json:"description"`
-	Amount      float64   `json:"amount"`
-	Type        string    `json:"type"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID          int              `json:"id"`
+	Date        time.Time        `json:"date"`
+	Description string           `json:"description"`
+	Merchant    *string          `json:"merchant"`
+	Amount      decimal.Decimal  `json:"amount"`
+	Currency    string           `json:"currency"`
+	Type        string           `json:"type"`
+	Category    *string          `json:"category"`
+	Note        *string          `json:"note"`
+	Tags        []string         `json:"tags"`
+	AccountID   *int             `json:"account_id"`
+	TransferID  *string          `json:"transfer_id"`
+	JobID       *string          `json:"job_id"`
+	ExternalID  *string          `json:"external_id"`
+	Cleared     bool             `json:"cleared"`
+	Version     int              `json:"version"`
+	CreatedAt   time.Time        `json:"created_at"`
+	DeletedAt   *time.Time       `json:"deleted_at,omitempty"`
+	Balance     *decimal.Decimal `json:"balance,omitempty"`
+	Splits      []Split          `json:"splits,omitempty"`
+}
+
+// transactionColumns lists the columns read by scanTransaction, in order. The
+// tag names are gathered by a subquery so every read and RETURNING clause
+// carries them without a separate lookup.
+const transactionColumns = "id, date, description, merchant, amount, currency, type, category, note, " + transactionTagsColumn +
+	", account_id, transfer_id, job_id, external_id, cleared, version, created_at, deleted_at"
+
+// transactionFields returns scan destinations matching transactionColumns.
+func transactionFields(t *Transaction) []any {
+	return []any{&t.ID, &t.Date, &t.Description, &t.Merchant, &t.Amount, &t.Currency, &t.Type, &t.Category, &t.Note, &t.Tags, &t.AccountID, &t.TransferID, &t.JobID, &t.ExternalID, &t.Cleared, &t.Version, &t.CreatedAt, &t.DeletedAt}
+}
+
+func scanTransaction(row pgx.Row, t *Transaction) error {
+	return row.Scan(transactionFields(t)...)
+}
+
+// balanceSource replaces the transactions table when the list endpoint is asked
+// for with_balance, populating Transaction.Balance. Credits add to and debits
+// subtract from a running balance assumed to be zero before each user's first
+// active transaction; soft-deleted rows never contribute.
+const balanceSource = "(SELECT *, SUM(CASE WHEN type = 'credit' THEN amount ELSE -amount END) " +
+	"OVER (PARTITION BY user_id ORDER BY date, id) AS balance " +
+	"FROM transactions WHERE deleted_at IS NULL) AS transactions"
+
+type transactionInput struct {
+	Date        time.Time        `json:"date" binding:"required"`
+	Description string           `json:"description" binding:"required,max=255"`
+	Amount      *decimal.Decimal `json:"amount" binding:"required,amount"`
+	Currency    string           `json:"currency" binding:"omitempty,iso4217"`
+	Type        string           `json:"type" binding:"required,transaction_type"`
+	Category    *string          `json:"category"`
+	Note        *string          `json:"note" binding:"omitempty,max=1000"`
+	AccountID   *int             `json:"account_id"`
 }
 
+// currency returns the input's currency, or defaultCurrency when omitted.
+func (in transactionInput) currency() string {
+	if in.Currency == "" {
+		return defaultCurrency
+	}
+	return in.Currency
+}
+
+// transactionUpdate is the PUT body: a full transaction plus the version the
+// client last read, so a concurrent edit is rejected rather than overwritten.
+type transactionUpdate struct {
+	transactionInput
+	Version *int `json:"version" binding:"required"`
+}
+
+type transactionPatch struct {
+	Version     *int             `json:"version" binding:"required"`
+	Date        *time.Time       `json:"date"`
+	Description *string          `json:"description" binding:"omitempty,min=1,max=255"`
+	Amount      *decimal.Decimal `json:"amount" binding:"omitempty,amount"`
+	Currency    *string          `json:"currency" binding:"omitempty,iso4217"`
+	Type        *string          `json:"type" binding:"omitempty,transaction_type"`
+	Category    *string          `json:"category"`
+	Note        *string          `json:"note" binding:"omitempty,max=1000"`
+	AccountID   *int             `json:"account_id"`
+}
+
+// Job tracks an import. ProcessedCount and TotalCount stay null until the
+// worker has parsed the file and knows how many rows it holds.
 type Job struct {
-	JobID     string    `json:"job_id"`
-	Status    string    `json:"status"`
-	CreatedAt time.Time `json:"created_at"`
+	JobID          string  `json:"job_id"`
+	Status         string  `json:"status"`
+	Error          *string `json:"error"`
+	ProcessedCount *int    `json:"processed_count"`
+	TotalCount     *int    `json:"total_count"`
+	// RowErrors lists the rows of the file that were skipped as invalid
+	RowErrors []importRowError `json:"row_errors,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
 }
 
 type API struct {
-	db     *pgxpool.Pool
-	router *gin.Engine
+	db Database
+	// replica serves the reads routed through reader; nil without one
+	replica      Database
+	router       *gin.Engine
+	jwtSecret    []byte
+	queryTimeout time.Duration
+	// defaultPageLimit and maxPageLimit bound list pages; see parsePagination
+	defaultPageLimit int
+	maxPageLimit     int
+	allowedOrigins   map[string]bool
+	metrics          *metrics
+	logger           *slog.Logger
+	limiter          *rateLimiter // per user
+	ipLimiter        *rateLimiter // per client IP
+	workers          *workerPool
+	webhooks         *webhookDispatcher
+	hub              *transactionHub
+	statsCache       *statsCache
+	baseCurrency     string
+	importDates      dateLayouts
+	attachmentsDir   string
+	maxBodySize      int64
+	maxUploadSize    int64
+	// maxFutureDays bounds how far ahead a transaction may be dated; see
+	// dateErrors
+	maxFutureDays int
+	// The http.Server timeouts Run applies
+	readHeaderTimeout time.Duration
+	readTimeout       time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+
+	// trigram is set when pg_trgm is installed; see detectTrigram
+	trigram bool
 }
 
-func NewAPI(db *pgxpool.Pool) *API {
+// NewAPI builds an API configured from the environment, falling back to
+// DefaultConfig for anything unset.
+func NewAPI(db Database) *API {
+	api, err := NewAPIWithConfig(db, configFromEnv())
+	if err != nil {
+		// configFromEnv never returns an invalid config
+		panic(err)
+	}
+	return api
+}
+
+// NewAPIWithConfig builds an API from cfg alone, without reading the
+// environment. It returns an error when cfg is invalid.
+func NewAPIWithConfig(db Database, cfg Config) (*API, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	// validate has already checked the formats
+	importDates, _ := dateFormatLayouts(cfg.ImportDateFormats)
+
+	origins := make(map[string]bool, len(cfg.AllowedOrigins))
+	for _, origin := range cfg.AllowedOrigins {
+		origins[strings.TrimSpace(origin)] = true
+	}
 	api := &API{
-		db:     db,
-		router: gin.Default(),
+		db:                db,
+		replica:           cfg.ReadReplica,
+		router:            gin.New(),
+		jwtSecret:         cfg.JWTSecret,
+		queryTimeout:      cfg.QueryTimeout,
+		defaultPageLimit:  cfg.DefaultPageLimit,
+		maxPageLimit:      cfg.MaxPageLimit,
+		allowedOrigins:    origins,
+		metrics:           newMetrics(db),
+		logger:            newLogger(cfg.LogLevel),
+		hub:               newTransactionHub(),
+		statsCache:        newStatsCache(cfg.StatsCacheTTL),
+		baseCurrency:      cfg.BaseCurrency,
+		importDates:       importDates,
+		attachmentsDir:    cfg.AttachmentsDir,
+		maxBodySize:       cfg.MaxBodySize,
+		maxUploadSize:     cfg.MaxUploadSize,
+		maxFutureDays:     cfg.MaxFutureDays,
+		readHeaderTimeout: cfg.ReadHeaderTimeout,
+		readTimeout:       cfg.ReadTimeout,
+		writeTimeout:      cfg.WriteTimeout,
+		idleTimeout:       cfg.IdleTimeout,
+		limiter:           newRateLimiter(cfg.RateLimit, cfg.RateBurst),
+		ipLimiter:         newRateLimiter(cfg.IPRateLimit, cfg.IPRateBurst),
 	}
 	api.setupRoutes()
-	return api
+	api.startWorkers(cfg.ImportWorkers)
+	api.startWebhooks(cfg.WebhookWorkers)
+	return api, nil
 }
 
 func (api *API) setupRoutes() {
-	// Enable CORS
-	api.router.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
-		c.Next()
-	})
+	// Log each request as JSON and recover from handler panics
+	api.router.Use(api.requestLogger, gin.Recovery())
+
+	// Trace requests, continuing any trace the caller started
+	api.router.Use(api.tracing)
+
+	// Record request metrics
+	api.router.Use(api.metrics.middleware)
+
+	// Enable CORS for allowlisted origins
+	api.router.Use(api.cors)
+
+	// Compress large responses for clients that accept gzip
+	api.router.Use(api.gzipResponse)
+
+	// Unauthenticated endpoints
+	api.router.GET("/health", api.health)
+	api.router.GET("/ready", api.ready)
+	api.router.GET(metricsPath, api.metrics.handler())
+	api.router.GET("/openapi.json", api.openAPI)
+	api.router.GET("/docs", api.docs)
+
+	// Everything below is rate limited per IP, requires a bearer token and is
+	// then rate limited per user. Request bodies are size limited, and
+	// successful writes clear the user's cached stats.
+	protected := api.router.Group("", api.rateLimitIP, api.requireAuth, api.rateLimit, api.limitBody, api.invalidateStats)
 
 	// Transaction endpoints
-	api.router.GET("/transactions", api.getTransactions)
-	api.router.GET("/transactions/:id", api.getTransaction)
-	api.router.GET("/stats", api.getStats)
-	api.router.DELETE(("/transactions/:id"), api.deleteTransaction)
-	api.router.DELETE("/jobs/most-recent", api.deleteMostRecentJob)
+	protected.GET("/transactions", api.getTransactions)
+	protected.GET("/transactions/export.csv", api.exportTransactionsCSV)
+	protected.GET("/transactions/export.xlsx", api.exportTransactionsXLSX)
+	protected.GET("/transactions/stream", api.streamTransactions)
+	protected.GET("/transactions/duplicates", api.getDuplicates)
+	protected.GET("/transactions/recurring", api.getRecurring)
+	protected.GET("/transactions/anomalies", api.getAnomalies)
+	protected.GET("/transactions/count", api.countTransactions)
+	protected.GET("/transactions/:id", api.getTransaction)
+	protected.HEAD("/transactions/:id", api.headTransaction)
+	protected.GET("/transactions/:id/related", api.getRelatedTransactions)
+	protected.POST("/transactions", api.createTransaction)
+	protected.POST("/transactions/bulk", api.bulkCreateTransactions)
+	protected.POST("/transactions/import", api.importTransactions)
+	protected.POST("/transactions/import/pdf", api.importPDF)
+	protected.POST("/transactions/delete", api.bulkDeleteTransactions)
+	protected.POST("/transactions/merge", api.mergeTransactions)
+	protected.POST("/transactions/recategorize", api.recategorizeTransactions)
+	protected.POST("/transactions/archive", api.archiveTransactions)
+	protected.POST("/transactions/:id/restore", api.restoreTransaction)
+	protected.POST("/transactions/:id/splits", api.setSplits)
+	protected.POST("/transactions/:id/tags", api.addTransactionTags)
+	protected.DELETE("/transactions/:id/tags/:tag", api.removeTransactionTag)
+	protected.POST("/transactions/:id/clear", api.clearTransaction)
+	protected.POST("/transactions/:id/unclear", api.unclearTransaction)
+	protected.PATCH("/transactions/:id/note", api.setTransactionNote)
+	protected.GET("/transactions/:id/attachments", api.getAttachments)
+	protected.POST("/transactions/:id/attachments", api.createAttachment)
+	protected.GET("/transactions/:id/attachments/:attachmentID", api.downloadAttachment)
+	protected.PUT("/transactions", api.upsertTransaction)
+	protected.PUT("/transactions/:id", api.updateTransaction)
+	protected.PATCH("/transactions/:id", api.patchTransaction)
+	protected.GET("/stats", api.getStats)
+	protected.GET("/stats/monthly", api.getMonthlyStats)
+	protected.GET("/stats/cashflow", api.getCashflow)
+	protected.GET("/stats/by-category", api.getCategoryStats)
+	protected.GET("/stats/by-merchant", api.getMerchantStats)
+	protected.GET("/stats/by-weekday", api.getWeekdayStats)
+	protected.GET("/stats/top-merchants", api.getTopMerchants)
+	protected.GET("/stats/trends", api.getTrends)
+	protected.GET("/stats/balance-series", api.getBalanceSeries)
+	protected.GET("/stats/distribution", api.getDistribution)
+	protected.DELETE(("/transactions/:id"), api.deleteTransaction)
+	protected.DELETE("/jobs/most-recent", api.deleteMostRecentJob)
+
+	// Account endpoints
+	protected.GET("/accounts", api.getAccounts)
+	protected.POST("/accounts", api.createAccount)
+	protected.POST("/transfers", api.createTransfer)
+
+	// Tag endpoints
+	protected.GET("/tags", api.getTags)
+	protected.POST("/tags", api.createTag)
+
+	// Saved filter endpoints
+	protected.GET("/filters", api.getSavedFilters)
+	protected.POST("/filters", api.createSavedFilter)
+	protected.DELETE("/filters/:name", api.deleteSavedFilter)
+
+	// Webhook endpoints
+	protected.GET("/webhooks", api.getWebhooks)
+	protected.POST("/webhooks", api.createWebhook)
+	protected.GET("/webhooks/:id", api.getWebhook)
+	protected.PUT("/webhooks/:id", api.updateWebhook)
+	protected.DELETE("/webhooks/:id", api.deleteWebhook)
+
+	// Categorization rule endpoints
+	protected.GET("/rules", api.getRules)
+	protected.POST("/rules", api.createRule)
+	protected.POST("/rules/preview", api.previewRule)
+	protected.GET("/rules/:id", api.getRule)
+	protected.PUT("/rules/:id", api.updateRule)
+	protected.DELETE("/rules/:id", api.deleteRule)
+
+	// Job endpoints
+	protected.GET("/jobs", api.getJobs)
+	protected.GET("/jobs/:id", api.getJob)
+	protected.HEAD("/jobs/:id", api.headJob)
+	protected.POST("/jobs/:id/cancel", api.cancelJob)
+	protected.POST("/jobs/:id/restore", api.restoreJob)
+
+	// Read-only GraphQL over the same queries as the routes above
+	graphQL := api.graphQLHandler()
+	protected.GET("/graphql", graphQL)
+	protected.POST("/graphql", graphQL)
+
+	// Answer OPTIONS on every path with the methods it supports. This comes
+	// last so it sees all of the routes above.
+	api.registerOptions()
 }
 
 func (api *API) getTransactions(c *gin.Context) {
-	rows, err := api.db.Query(context.Background(),
-		"SELECT id, date, description, amount, type, created_at FROM transactions ORDER BY date DESC")
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	if !api.expandSavedFilter(ctx, c) {
+		return
+	}
+
+	limit, offset, err := api.parsePagination(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
 		return
 	}
-	defer rows.Close()
 
-	var transactions []Transaction
-	for rows.Next() {
-		var t Transaction
-		if err := rows.Scan(&t.ID, &t.Date, &t.Description, &t.Amount, &t.Type, &t.CreatedAt); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	filter, err := api.parseTransactionFilter(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	orderBy, err := parseSort(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	// Closest matches come first unless the caller picked a sort
+	if rank := filter.similarityRank(); rank != "" && c.Query("sort") == "" {
+		orderBy = rank + ", " + orderBy
+	}
+
+	fields, err := parseFields(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	withBalance := false
+	if v := c.Query("with_balance"); v != "" {
+		if withBalance, err = strconv.ParseBool(v); err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("invalid with_balance %q", v))
 			return
 		}
-		transactions = append(transactions, t)
 	}
 
-	c.JSON(http.StatusOK, transactions)
+	expandSplits, err := parseExpandSplits(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	cursor, err := parseCursor(c.Query("cursor"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	// Keyset pagination relies on the default (date, id) ordering
+	keyset := orderBy == defaultOrderBy
+	if cursor != nil && (!keyset || offset != 0) {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest,
+			"cursor cannot be combined with offset or a custom sort")
+		return
+	}
+
+	// The list is dashboard traffic and may lag the primary slightly
+	db := api.reader()
+	total, err := countMatching(ctx, db, filter)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	page := filter.clone()
+	if cursor != nil {
+		page.add("(date, id) < ($%d, $%d)", cursor.Date, cursor.ID)
+	}
+	transactions, err := listTransactions(ctx, db, page, orderBy, limit, offset, withBalance)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	if expandSplits {
+		if err := api.loadSplits(ctx, transactions); err != nil {
+			respondDBError(c, err)
+			return
+		}
+	}
+
+	// A full page may have more rows after it; hand out a cursor to fetch them
+	var nextCursor *string
+	if keyset && limit > 0 && len(transactions) == limit {
+		last := transactions[len(transactions)-1]
+		next := encodeCursor(transactionCursor{Date: last.Date, ID: last.ID})
+		nextCursor = &next
+	}
+
+	setPaginationLinks(c, limit, offset, total, cursor != nil, nextCursor)
+
+	var body any = transactions
+	if fields != nil {
+		body = sparseTransactions(transactions, fields)
+	}
+
+	respondJSONWithETag(c, gin.H{
+		"total":        total,
+		"limit":        limit,
+		"offset":       offset,
+		"next_cursor":  nextCursor,
+		"transactions": body,
+	})
+}
+
+// listTransactions reads one page of the transactions matching filter from db
+// in orderBy order. With withBalance each carries its running balance.
+func listTransactions(ctx context.Context, db Querier, filter *transactionFilter, orderBy string, limit, offset int, withBalance bool) ([]Transaction, error) {
+	columns, source := transactionColumns, "transactions"
+	if withBalance {
+		columns, source = transactionColumns+", balance", balanceSource
+	}
+
+	args := append(filter.clone().args, limit, offset)
+	var transactions []Transaction
+	err := withRetry(ctx, func() error {
+		rows, err := db.Query(ctx,
+			fmt.Sprintf("SELECT %s FROM %s%s ORDER BY %s LIMIT $%d OFFSET $%d",
+				columns, source, filter.where(), orderBy, len(args)-1, len(args)),
+			args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		// Start over on every attempt so a retry never duplicates rows
+		transactions = []Transaction{}
+		for rows.Next() {
+			var t Transaction
+			fields := transactionFields(&t)
+			if withBalance {
+				fields = append(fields, &t.Balance)
+			}
+			if err := rows.Scan(fields...); err != nil {
+				return err
+			}
+			transactions = append(transactions, t)
+		}
+		return rows.Err()
+	})
+	return transactions, err
+}
+
+// countMatching counts the transactions in db matching filter.
+func countMatching(ctx context.Context, db Querier, filter *transactionFilter) (int, error) {
+	var count int
+	err := withRetry(ctx, func() error {
+		return db.QueryRow(ctx, "SELECT COUNT(*) FROM transactions"+filter.where(), filter.args...).Scan(&count)
+	})
+	return count, err
+}
+
+// countTransactions returns how many transactions match the list endpoint's
+// filters without fetching them.
+func (api *API) countTransactions(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	filter, err := api.parseTransactionFilter(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	count, err := countMatching(ctx, api.reader(), filter)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"count": count})
+}
+
+// transactionFilter accumulates WHERE predicates and their positional
+// arguments for queries over the transactions table.
+type transactionFilter struct {
+	conditions []string
+	args       []any
+
+	// similarArg is the placeholder index of the similar search term, or 0;
+	// see similarityRank
+	similarArg int
+}
+
+// add appends a predicate whose %d verbs are replaced, in order, with the
+// placeholder indexes assigned to values.
+func (f *transactionFilter) add(condition string, values ...any) {
+	placeholders := make([]any, len(values))
+	for i, v := range values {
+		f.args = append(f.args, v)
+		placeholders[i] = len(f.args)
+	}
+	f.conditions = append(f.conditions, fmt.Sprintf(condition, placeholders...))
+}
+
+// addCondition appends a predicate that takes no arguments.
+func (f *transactionFilter) addCondition(condition string) {
+	f.conditions = append(f.conditions, condition)
+}
+
+func (f *transactionFilter) clone() *transactionFilter {
+	return &transactionFilter{
+		conditions: append([]string(nil), f.conditions...),
+		args:       append([]any(nil), f.args...),
+		similarArg: f.similarArg,
+	}
+}
+
+func (f *transactionFilter) where() string {
+	if len(f.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(f.conditions, " AND ")
+}
+
+// parseTransactionFilter builds a filter from the list endpoint's query
+// parameters, scoped to the current user. Every parameter is optional.
+func (api *API) parseTransactionFilter(c *gin.Context) (*transactionFilter, error) {
+	f := userFilter(c)
+
+	includeDeleted, err := parseIncludeDeleted(c)
+	if err != nil {
+		return nil, err
+	}
+	if !includeDeleted {
+		f.addCondition("deleted_at IS NULL")
+	}
+
+	if err := f.addDateRange(c); err != nil {
+		return nil, err
+	}
+
+	if v := c.Query("type"); v != "" {
+		if !validTransactionTypes[v] {
+			return nil, fmt.Errorf("invalid type %q: must be debit or credit", v)
+		}
+		f.add("type = $%d", v)
+	}
+
+	if v := c.Query("category"); v != "" {
+		f.add("category = $%d", v)
+	}
+
+	if err := f.addAccount(c); err != nil {
+		return nil, err
+	}
+
+	if v := c.Query("cleared"); v != "" {
+		cleared, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cleared %q", v)
+		}
+		f.add("cleared = $%d", cleared)
+	}
+
+	if v := c.Query("min_amount"); v != "" {
+		minAmount, err := decimal.NewFromString(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid min_amount %q", v)
+		}
+		f.add("amount >= $%d", minAmount)
+	}
+	if v := c.Query("max_amount"); v != "" {
+		maxAmount, err := decimal.NewFromString(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max_amount %q", v)
+		}
+		f.add("amount <= $%d", maxAmount)
+	}
+
+	if v := strings.TrimSpace(c.Query("q")); v != "" {
+		f.add("description ILIKE '%%' || $%d || '%%'", escapeLike(v))
+	}
+
+	if err := f.addTags(c); err != nil {
+		return nil, err
+	}
+
+	api.addSimilar(c, f)
+
+	return f, nil
+}
+
+// addAccount applies the optional account_id query parameter.
+func (f *transactionFilter) addAccount(c *gin.Context) error {
+	v := c.Query("account_id")
+	if v == "" {
+		return nil
+	}
+	accountID, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("invalid account_id %q", v)
+	}
+	f.add("account_id = $%d", accountID)
+	return nil
+}
+
+// parseIncludeDeleted reads the include_deleted query parameter, which lets
+// reads return soft-deleted transactions alongside active ones.
+func parseIncludeDeleted(c *gin.Context) (bool, error) {
+	v := c.Query("include_deleted")
+	if v == "" {
+		return false, nil
+	}
+	include, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid include_deleted %q", v)
+	}
+	return include, nil
+}
+
+// addDateRange applies the optional from and to query parameters.
+func (f *transactionFilter) addDateRange(c *gin.Context) error {
+	if v := c.Query("from"); v != "" {
+		from, _, err := parseDateParam(v)
+		if err != nil {
+			return fmt.Errorf("invalid from date %q: use RFC3339 or YYYY-MM-DD", v)
+		}
+		f.add("date >= $%d", from)
+	}
+	if v := c.Query("to"); v != "" {
+		to, dateOnly, err := parseDateParam(v)
+		if err != nil {
+			return fmt.Errorf("invalid to date %q: use RFC3339 or YYYY-MM-DD", v)
+		}
+		// A bare date covers the whole day
+		if dateOnly {
+			f.add("date < $%d", to.AddDate(0, 0, 1))
+		} else {
+			f.add("date <= $%d", to)
+		}
+	}
+	return nil
+}
+
+// escapeLike escapes LIKE wildcards so user input matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// parseDateParam accepts either an RFC3339 timestamp or a YYYY-MM-DD date,
+// reporting which form was used.
+func parseDateParam(v string) (t time.Time, dateOnly bool, err error) {
+	if t, err = time.Parse(time.RFC3339, v); err == nil {
+		return t, false, nil
+	}
+	if t, err = time.Parse(time.DateOnly, v); err == nil {
+		return t, true, nil
+	}
+	return time.Time{}, false, err
+}
+
+// sortColumns whitelists the columns the list endpoint may be ordered by, since
+// identifiers cannot be passed as query parameters.
+var sortColumns = map[string]bool{
+	"date":       true,
+	"amount":     true,
+	"created_at": true,
+	"id":         true,
+}
+
+// defaultOrderBy is the list ordering used when no sort is requested, and the
+// only one cursor pagination supports.
+const defaultOrderBy = "date DESC, id DESC"
+
+// parseSort builds an ORDER BY expression from the sort and order query
+// parameters, defaulting to date DESC. Ties are broken by id so pages are
+// stable.
+func parseSort(c *gin.Context) (string, error) {
+	column := c.DefaultQuery("sort", "date")
+	if !sortColumns[column] {
+		return "", fmt.Errorf("invalid sort column %q", column)
+	}
+
+	direction := strings.ToUpper(c.DefaultQuery("order", "desc"))
+	if direction != "ASC" && direction != "DESC" {
+		return "", fmt.Errorf("invalid order %q: must be asc or desc", c.Query("order"))
+	}
+
+	if column == "id" {
+		return "id " + direction, nil
+	}
+	return column + " " + direction + ", id " + direction, nil
+}
+
+// transactionCursor is the keyset position of the last row on a page.
+type transactionCursor struct {
+	Date time.Time `json:"d"`
+	ID   int       `json:"i"`
+}
+
+// encodeCursor serializes a cursor into an opaque URL-safe token.
+func encodeCursor(cur transactionCursor) string {
+	b, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// parseCursor decodes a token produced by encodeCursor, returning nil when
+// no cursor was supplied.
+func parseCursor(v string) (*transactionCursor, error) {
+	if v == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	var cur transactionCursor
+	if err := json.Unmarshal(b, &cur); err != nil || cur.ID == 0 {
+		return nil, errors.New("invalid cursor")
+	}
+	return &cur, nil
+}
+
+// parsePagination reads the limit and offset query parameters, applying the
+// configured default when limit is omitted and capping it at the maximum.
+func (api *API) parsePagination(c *gin.Context) (limit, offset int, err error) {
+	limit = api.defaultPageLimit
+	if v := c.Query("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return 0, 0, fmt.Errorf("invalid limit %q", v)
+		}
+		if limit > api.maxPageLimit {
+			limit = api.maxPageLimit
+		}
+	}
+	if v := c.Query("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("invalid offset %q", v)
+		}
+	}
+	return limit, offset, nil
+}
+
+// headTransaction answers whether a transaction exists without reading or
+// serializing it.
+func (api *API) headTransaction(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	includeDeleted, err := parseIncludeDeleted(c)
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	query := "SELECT EXISTS (SELECT 1 FROM transactions WHERE id = $1 AND user_id = $2"
+	if !includeDeleted {
+		query += " AND deleted_at IS NULL"
+	}
+	query += ")"
+
+	var exists bool
+	err = withRetry(ctx, func() error {
+		return api.db.QueryRow(ctx, query, c.Param("id"), currentUserID(c)).Scan(&exists)
+	})
+	respondExists(c, exists, err)
+}
+
+// respondExists finishes a HEAD request with a bare status.
+func respondExists(c *gin.Context, exists bool, err error) {
+	switch {
+	case err != nil:
+		status, _, _ := classifyDBError(err)
+		c.AbortWithStatus(status)
+	case !exists:
+		c.AbortWithStatus(http.StatusNotFound)
+	default:
+		c.Status(http.StatusOK)
+	}
 }
 
 func (api *API) getTransaction(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	includeDeleted, err := parseIncludeDeleted(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	expandSplits, err := parseExpandSplits(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	t, err := api.findTransaction(ctx, currentUserID(c), c.Param("id"), includeDeleted)
+	if errors.Is(err, pgx.ErrNoRows) {
+		respondError(c, http.StatusNotFound, codeNotFound, "Transaction not found")
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	if expandSplits {
+		transactions := []Transaction{t}
+		if err := api.loadSplits(ctx, transactions); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		t = transactions[0]
+	}
+
+	respondJSONWithETag(c, t)
+}
+
+// findTransaction reads one of userID's transactions, returning pgx.ErrNoRows
+// when it doesn't exist or, unless includeDeleted, has been soft-deleted.
+func (api *API) findTransaction(ctx context.Context, userID, id string, includeDeleted bool) (Transaction, error) {
+	query := "SELECT " + transactionColumns + " FROM transactions WHERE id = $1 AND user_id = $2"
+	if !includeDeleted {
+		query += " AND deleted_at IS NULL"
+	}
+
+	var t Transaction
+	err := withRetry(ctx, func() error {
+		return scanTransaction(api.db.QueryRow(ctx, query, id, userID), &t)
+	})
+	return t, err
+}
+
+func (api *API) createTransaction(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	// The raw body is kept so idempotent retries can be compared against it
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		respondBodyError(c, err)
+		return
+	}
+	var input transactionInput
+	if err := binding.JSON.BindBody(body, &input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if !api.checkDate(c, &input.Date) {
+		return
+	}
+
+	t := Transaction{
+		Date:        input.Date,
+		Description: input.Description,
+		Amount:      *input.Amount,
+		Currency:    input.currency(),
+		Type:        input.Type,
+		Category:    input.Category,
+		Note:        input.Note,
+		AccountID:   input.AccountID,
+	}
+	if !api.checkAccount(ctx, c, t.AccountID) {
+		return
+	}
+
+	if key := strings.TrimSpace(c.GetHeader(idempotencyKeyHeader)); key != "" {
+		api.createTransactionIdempotently(ctx, c, key, body, &t)
+		return
+	}
+
+	if err := insertTransaction(ctx, api.db, currentUserID(c), &t); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	api.notifyWebhooks(currentUserID(c), eventTransactionCreated, t.ID)
+
+	c.JSON(http.StatusCreated, t)
+}
+
+// insertTransaction stores a new transaction owned by userID, filling in its
+// generated id and created_at.
+func insertTransaction(ctx context.Context, q rowQuerier, userID string, t *Transaction) error {
+	return q.QueryRow(ctx,
+		"INSERT INTO transactions (date, description, amount, currency, type, category, note, account_id, user_id) "+
+			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING "+transactionColumns,
+		t.Date, t.Description, t.Amount, t.Currency, t.Type, t.Category, t.Note, t.AccountID, userID).
+		Scan(transactionFields(t)...)
+}
+
+func (api *API) updateTransaction(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
 	id := c.Param("id")
+	var input transactionUpdate
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if !api.checkDate(c, &input.Date) {
+		return
+	}
+
+	if !api.checkAccount(ctx, c, input.AccountID) {
+		return
+	}
+
+	tx, err := api.db.Begin(ctx)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	if !api.checkSplitsForUpdate(ctx, c, tx, id, *input.Amount) {
+		return
+	}
+
 	var t Transaction
+	err = scanTransaction(tx.QueryRow(ctx,
+		"UPDATE transactions SET date = $1, description = $2, amount = $3, currency = $4, type = $5, category = $6, "+
+			"note = $7, account_id = $8, version = version + 1 "+
+			"WHERE id = $9 AND user_id = $10 AND deleted_at IS NULL AND version = $11 RETURNING "+transactionColumns,
+		input.Date, input.Description, *input.Amount, input.currency(), input.Type, input.Category, input.Note, input.AccountID,
+		id, currentUserID(c), *input.Version), &t)
+	if errors.Is(err, pgx.ErrNoRows) {
+		api.respondVersionMismatch(ctx, c, id)
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		respondDBError(c, err)
+		return
+	}
 
-	err := api.db.QueryRow(context.Background(),
-		"SELECT id, date, description, amount, type, created_at FROM transactions WHERE id = $1", id).
-		Scan(&t.ID, &t.Date, &t.Description, &t.Amount, &t.Type, &t.CreatedAt)
+	c.JSON(http.StatusOK, t)
+}
 
+// checkSplitsForUpdate rejects a new amount that existing splits no longer
+// add up to, holding the row lock in tx so setSplits can't race the update.
+// It writes the error response and returns false when the update must stop.
+func (api *API) checkSplitsForUpdate(ctx context.Context, c *gin.Context, tx pgx.Tx, id string, amount decimal.Decimal) bool {
+	msg, err := checkSplitsSum(ctx, tx, id, currentUserID(c), amount)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+		respondDBError(c, err)
+		return false
+	}
+	if msg != "" {
+		respondError(c, http.StatusUnprocessableEntity, codeValidationFailed, msg)
+		return false
+	}
+	return true
+}
+
+// respondVersionMismatch explains why a versioned update matched no row:
+// either the transaction is gone, or someone else updated it first.
+func (api *API) respondVersionMismatch(ctx context.Context, c *gin.Context, id string) {
+	var current int
+	err := api.db.QueryRow(ctx,
+		"SELECT version FROM transactions WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL", id, currentUserID(c)).
+		Scan(&current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		respondError(c, http.StatusNotFound, codeNotFound, "Transaction not found")
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	respondErrorDetails(c, http.StatusConflict, codeConflict,
+		"Transaction was modified by another request; fetch it and retry", gin.H{"current_version": current})
+}
+
+func (api *API) patchTransaction(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	id := c.Param("id")
+	var input transactionPatch
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if !api.checkDate(c, input.Date) {
+		return
+	}
+
+	// Only update the columns present in the body
+	var sets []string
+	var args []any
+	addSet := func(column string, value any) {
+		args = append(args, value)
+		sets = append(sets, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+	if input.Date != nil {
+		addSet("date", *input.Date)
+	}
+	if input.Description != nil {
+		addSet("description", *input.Description)
+	}
+	if input.Amount != nil {
+		addSet("amount", *input.Amount)
+	}
+	if input.Currency != nil {
+		addSet("currency", *input.Currency)
+	}
+	if input.Type != nil {
+		addSet("type", *input.Type)
+	}
+	if input.Category != nil {
+		addSet("category", *input.Category)
+	}
+	if input.Note != nil {
+		addSet("note", *input.Note)
+	}
+	if input.AccountID != nil {
+		if !api.checkAccount(ctx, c, input.AccountID) {
+			return
+		}
+		addSet("account_id", *input.AccountID)
+	}
+
+	// An empty patch still checks the version, so a stale client finds out
+	var query string
+	if len(sets) == 0 {
+		query = "SELECT " + transactionColumns + " FROM transactions WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL AND version = $3"
+		args = []any{id, currentUserID(c), *input.Version}
+	} else {
+		sets = append(sets, "version = version + 1")
+		args = append(args, id, currentUserID(c), *input.Version)
+		query = fmt.Sprintf("UPDATE transactions SET %s WHERE id = $%d AND user_id = $%d AND deleted_at IS NULL AND version = $%d RETURNING %s",
+			strings.Join(sets, ", "), len(args)-2, len(args)-1, len(args), transactionColumns)
+	}
+
+	tx, err := api.db.Begin(ctx)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	if input.Amount != nil && !api.checkSplitsForUpdate(ctx, c, tx, id, *input.Amount) {
+		return
+	}
+
+	var t Transaction
+	err = scanTransaction(tx.QueryRow(ctx, query, args...), &t)
+	if errors.Is(err, pgx.ErrNoRows) {
+		api.respondVersionMismatch(ctx, c, id)
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		respondDBError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, t)
 }
 
+// Stats summarizes the transactions matching a filter. Amounts are in
+// BaseCurrency; transactions in a currency with no rate to it are counted in
+// TotalTransactions but totalled separately under Unconverted, with
+// MissingRates set. CachedAt is when the figures were computed, which may be
+// up to STATS_CACHE_TTL ago.
+type Stats struct {
+	TotalTransactions int              `json:"total_transactions"`
+	BaseCurrency      string           `json:"base_currency"`
+	TotalDebits       decimal.Decimal  `json:"total_debits"`
+	TotalCredits      decimal.Decimal  `json:"total_credits"`
+	NetBalance        decimal.Decimal  `json:"net_balance"`
+	ClearedBalance    decimal.Decimal  `json:"cleared_balance"`
+	UnclearedBalance  decimal.Decimal  `json:"uncleared_balance"`
+	MissingRates      bool             `json:"missing_rates"`
+	Unconverted       []CurrencyTotals `json:"unconverted,omitempty"`
+	CachedAt          time.Time        `json:"cached_at"`
+}
+
 func (api *API) getStats(c *gin.Context) {
-	stats := struct {
-		TotalTransactions int     `json:"total_transactions"`
-		TotalDebits       float64 `json:"total_debits"`
-		TotalCredits      float64 `json:"total_credits"`
-	}{}
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
 
-	// Get transaction counts and totals
-	err := api.db.QueryRow(context.Background(), "SELECT COUNT(*) FROM transactions").Scan(&stats.TotalTransactions)
+	filter, err := parseStatsFilter(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
 		return
 	}
 
-	err = api.db.QueryRow(context.Background(),
-		"SELECT COALESCE(SUM(amount), 0) FROM transactions WHERE type = 'debit'").Scan(&stats.TotalDebits)
+	stats, err := api.loadStats(ctx, api.reader(), currentUserID(c), filter)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondDBError(c, err)
 		return
 	}
+	respondStats(c, stats)
+}
+
+// parseStatsFilter builds the stats filter from the from, to and account_id
+// query parameters, over the current user's active transactions.
+func parseStatsFilter(c *gin.Context) (*transactionFilter, error) {
+	filter := activeFilter(c)
+	if err := filter.addDateRange(c); err != nil {
+		return nil, err
+	}
+	if err := filter.addAccount(c); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
 
-	err = api.db.QueryRow(context.Background(),
-		"SELECT COALESCE(SUM(amount), 0) FROM transactions WHERE type = 'credit'").Scan(&stats.TotalCredits)
+// loadStats computes the stats for userID's transactions matching filter,
+// reading from db. Dashboards poll for these, so recent results are served
+// from memory.
+func (api *API) loadStats(ctx context.Context, db Querier, userID string, filter *transactionFilter) (Stats, error) {
+	key := statsCacheKey(filter)
+	if cached, ok := api.statsCache.get(userID, key, time.Now()); ok {
+		return cached, nil
+	}
+
+	stats := Stats{BaseCurrency: api.baseCurrency}
+	source := convertedSource(api.baseCurrency)
+
+	// Get transaction counts and totals
+	var err error
+	if stats.TotalTransactions, err = countMatching(ctx, db, filter); err != nil {
+		return Stats{}, err
+	}
+
+	debits := filter.clone()
+	debits.add("type = $%d", "debit")
+	err = withRetry(ctx, func() error {
+		return db.QueryRow(ctx,
+			"SELECT COALESCE(SUM(base_amount), 0) FROM "+source+debits.where(), debits.args...).Scan(&stats.TotalDebits)
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		return Stats{}, err
+	}
+
+	credits := filter.clone()
+	credits.add("type = $%d", "credit")
+	err = withRetry(ctx, func() error {
+		return db.QueryRow(ctx,
+			"SELECT COALESCE(SUM(base_amount), 0) FROM "+source+credits.where(), credits.args...).Scan(&stats.TotalCredits)
+	})
+	if err != nil {
+		return Stats{}, err
+	}
+
+	// Net balance is credits minus debits, so it goes negative when spending exceeds income
+	stats.NetBalance = stats.TotalCredits.Sub(stats.TotalDebits)
+
+	// The cleared split uses the same sign convention, letting it be checked
+	// against the balance on a bank statement
+	err = withRetry(ctx, func() error {
+		return db.QueryRow(ctx,
+			"SELECT COALESCE(SUM(CASE WHEN type = 'credit' THEN base_amount ELSE -base_amount END) FILTER (WHERE cleared), 0), "+
+				"COALESCE(SUM(CASE WHEN type = 'credit' THEN base_amount ELSE -base_amount END) FILTER (WHERE NOT cleared), 0) "+
+				"FROM "+source+filter.where(), filter.args...).Scan(&stats.ClearedBalance, &stats.UnclearedBalance)
+	})
+	if err != nil {
+		return Stats{}, err
+	}
+
+	// Rows without a rate are reported in their own currency rather than
+	// failing the whole request
+	unconverted := filter.clone()
+	unconverted.addCondition("base_amount IS NULL")
+	err = withRetry(ctx, func() error {
+		rows, err := db.Query(ctx,
+			"SELECT currency, COUNT(*), COALESCE(SUM(amount) FILTER (WHERE type = 'debit'), 0), "+
+				"COALESCE(SUM(amount) FILTER (WHERE type = 'credit'), 0) "+
+				"FROM "+source+unconverted.where()+" GROUP BY currency ORDER BY currency", unconverted.args...)
+		if err != nil {
+			return err
+		}
+		stats.Unconverted, err = pgx.CollectRows(rows, pgx.RowToStructByPos[CurrencyTotals])
+		return err
+	})
+	if err != nil {
+		return Stats{}, err
 	}
+	stats.MissingRates = len(stats.Unconverted) > 0
 
-	c.JSON(http.StatusOK, stats)
+	stats.CachedAt = time.Now()
+	api.statsCache.put(userID, key, stats)
+	return stats, nil
+}
+
+// respondStats writes stats with an ETag over the figures alone, leaving out
+// cached_at, so the tag only changes when the totals do.
+func respondStats(c *gin.Context, stats Stats) {
+	data, err := json.Marshal(stats)
+	if err != nil {
+		c.Error(err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Internal server error")
+		return
+	}
+	figures := stats
+	figures.CachedAt = time.Time{}
+	tagged, err := json.Marshal(figures)
+	if err != nil {
+		c.Error(err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "Internal server error")
+		return
+	}
+	writeWithETag(c, contentETag(tagged), data)
 }
 
 func (api *API) deleteTransaction(c *gin.Context) {
-	// Delete a transaction
+	// Soft delete a transaction so it can be restored later
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
 	id := c.Param("id")
 
-	result, err := api.db.Exec(context.Background(), "DELETE FROM transactions WHERE id = $1", id)
+	result, err := api.db.Exec(ctx,
+		"UPDATE transactions SET deleted_at = now() WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL", id, currentUserID(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondDBError(c, err)
 		return
 	}
 
 	if result.RowsAffected() == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+		respondError(c, http.StatusNotFound, codeNotFound, "Transaction not found")
 		return
 	}
+	if id, err := strconv.Atoi(id); err == nil {
+		api.notifyWebhooks(currentUserID(c), eventTransactionDeleted, id)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Transaction deleted"})
 }
 
+func (api *API) restoreTransaction(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	id := c.Param("id")
+	var t Transaction
+
+	err := scanTransaction(api.db.QueryRow(ctx,
+		"UPDATE transactions SET deleted_at = NULL WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL RETURNING "+transactionColumns,
+		id, currentUserID(c)), &t)
+	if errors.Is(err, pgx.ErrNoRows) {
+		respondError(c, http.StatusNotFound, codeNotFound, "Deleted transaction not found")
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, t)
+}
+
+func (api *API) bulkDeleteTransactions(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	var input struct {
+		IDs []int `json:"ids" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	if len(input.IDs) == 0 || len(input.IDs) > maxBulkDeleteIDs {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest,
+			fmt.Sprintf("ids must contain between 1 and %d entries", maxBulkDeleteIDs))
+		return
+	}
+
+	tx, err := api.db.Begin(ctx)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx,
+		"UPDATE transactions SET deleted_at = now() WHERE id = ANY($1) AND user_id = $2 AND deleted_at IS NULL RETURNING id",
+		input.IDs, currentUserID(c))
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	deleted, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	api.notifyWebhooks(currentUserID(c), eventTransactionDeleted, deleted...)
+
+	found := make(map[int]bool, len(deleted))
+	for _, id := range deleted {
+		found[id] = true
+	}
+	notFound := []int{}
+	for _, id := range input.IDs {
+		if !found[id] {
+			notFound = append(notFound, id)
+			found[id] = true // report repeated ids once
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deleted": len(deleted), "not_found": notFound})
+}
+
 func (api *API) deleteMostRecentJob(c *gin.Context) {
 	// Delete transaction done by most recent job by getting job_id of most recent transacion and deleting all transactions with same job_id
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
 	var jobID string
-	err := api.db.QueryRow(context.Background(), "SELECT job_id FROM transactions ORDER BY created_at DESC LIMIT 1").Scan(&jobID)
+	err := api.db.QueryRow(ctx,
+		"SELECT job_id FROM transactions WHERE user_id = $1 AND job_id IS NOT NULL AND deleted_at IS NULL ORDER BY created_at DESC LIMIT 1",
+		currentUserID(c)).Scan(&jobID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		respondError(c, http.StatusNotFound, codeNotFound, "Transaction not found")
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondDBError(c, err)
 		return
 	}
 
-	result, err := api.db.Exec(context.Background(), "DELETE FROM transactions WHERE job_id = $1", jobID)
+	rows, err := api.db.Query(ctx,
+		"UPDATE transactions SET deleted_at = now() WHERE job_id = $1 AND user_id = $2 AND deleted_at IS NULL RETURNING id",
+		jobID, currentUserID(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondDBError(c, err)
 		return
 	}
-	if result.RowsAffected() == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+	deleted, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if len(deleted) == 0 {
+		respondError(c, http.StatusNotFound, codeNotFound, "Transaction not found")
 		return
 	}
+	api.notifyWebhooks(currentUserID(c), eventTransactionDeleted, deleted...)
 	c.JSON(http.StatusOK, gin.H{"message": "Most recent job transactions deleted"})
 }
 
+// Run serves the API on addr until the process receives SIGINT or SIGTERM,
+// then stops accepting connections and waits up to shutdownTimeout for
+// in-flight requests to finish.
 func (api *API) Run(addr string) error {
-	return api.router.Run(addr)
+	// Long-lived responses such as the event stream opt out of WriteTimeout
+	// themselves, via disableWriteTimeout
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           api.router,
+		ReadHeaderTimeout: api.readHeaderTimeout,
+		ReadTimeout:       api.readTimeout,
+		WriteTimeout:      api.writeTimeout,
+		IdleTimeout:       api.idleTimeout,
+	}
+	server.RegisterOnShutdown(api.hub.close)
+
+	errCh := make(chan error, 1)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errCh <- err
+		}
+		close(errCh)
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Println("Shutting down server...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := server.Shutdown(shutdownCtx)
+
+	// No new imports can arrive once the server has stopped, so let the
+	// workers finish what is already queued
+	if werr := api.stopWorkers(shutdownCtx); err == nil {
+		err = werr
+	}
+	// Imports are finished, so nothing else can queue deliveries
+	if werr := api.stopWebhooks(shutdownCtx); err == nil {
+		err = werr
+	}
+	return err
 }
 
 // Main function would look like this
 func main() {
-	dbURL := "postgresql://junpark@localhost:5432/bankstatements"
-	pool, err := pgxpool.New(context.Background(), dbURL)
+	cfg, err := loadServerConfig()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v\n", err)
+	}
+
+	if cfg.TraceEndpoint != "" {
+		shutdown, err := setupTracing(context.Background(), cfg.TraceEndpoint, cfg.TraceService)
+		if err != nil {
+			log.Fatalf("Unable to set up tracing: %v\n", err)
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdown(ctx); err != nil {
+				log.Printf("Flushing traces failed: %v\n", err)
+			}
+		}()
+		cfg.Pool.ConnConfig.Tracer = queryTracer{}
+		log.Printf("Exporting traces to %s\n", cfg.TraceEndpoint)
+	}
+	if cfg.SlowQueryThreshold > 0 {
+		cfg.Pool.ConnConfig.Tracer = &slowQueryTracer{
+			threshold: cfg.SlowQueryThreshold,
+			logger:    newLogger(os.Getenv("LOG_LEVEL")),
+			next:      cfg.Pool.ConnConfig.Tracer,
+		}
+	}
+	if cfg.ReadPool != nil {
+		cfg.ReadPool.ConnConfig.Tracer = cfg.Pool.ConnConfig.Tracer
+	}
+
+	log.Printf("Database pool: max_conns=%d min_conns=%d max_conn_lifetime=%s max_conn_idle_time=%s\n",
+		cfg.Pool.MaxConns, cfg.Pool.MinConns, cfg.Pool.MaxConnLifetime, cfg.Pool.MaxConnIdleTime)
+	pool, err := pgxpool.NewWithConfig(context.Background(), cfg.Pool)
 	if err != nil {
 		log.Fatalf("Unable to connect to database: %v\n", err)
 	}
 	defer pool.Close()
 
-	api := NewAPI(pool)
-	api.Run(":8050")
+	if cfg.Migrate {
+		if err := migrate(context.Background(), pool); err != nil {
+			log.Fatalf("Unable to migrate database: %v\n", err)
+		}
+	}
+
+	apiCfg := configFromEnv()
+	if cfg.ReadPool != nil {
+		replica, err := pgxpool.NewWithConfig(context.Background(), cfg.ReadPool)
+		if err != nil {
+			log.Fatalf("Unable to connect to read replica: %v\n", err)
+		}
+		defer replica.Close()
+		apiCfg.ReadReplica = replica
+		log.Printf("Routing dashboard reads to the read replica\n")
+	}
+
+	// Run blocks until the server has drained, so the deferred pool.Close runs last
+	api, err := NewAPIWithConfig(pool, apiCfg)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v\n", err)
+	}
+	api.detectTrigram(context.Background())
+	if err := api.Run(cfg.ListenAddr); err != nil {
+		log.Printf("Server error: %v\n", err)
+	}
 }
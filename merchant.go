@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+// merchantPrefixPattern matches card-processor and point-of-sale prefixes
+// that banks put in front of the merchant name, e.g. "SQ *" or "TST* ".
+var merchantPrefixPattern = regexp.MustCompile(
+	`(?i)^(?:SQ ?\*|SQU ?\*|TST ?\*|SP ?\*|PP ?\*|PAYPAL ?\*|POS (?:PURCHASE |DEBIT )?|DEBIT CARD PURCHASE |CHECKCARD |PURCHASE (?:AUTHORIZED ON \d{2}/\d{2} )?)\s*`)
+
+// usStates holds the postal codes that end a "CITY ST" location suffix.
+var usStates = map[string]bool{
+	"AL": true, "AK": true, "AZ": true, "AR": true, "CA": true, "CO": true, "CT": true, "DE": true, "DC": true,
+	"FL": true, "GA": true, "HI": true, "ID": true, "IL": true, "IN": true, "IA": true, "KS": true, "KY": true,
+	"LA": true, "ME": true, "MD": true, "MA": true, "MI": true, "MN": true, "MS": true, "MO": true, "MT": true,
+	"NE": true, "NV": true, "NH": true, "NJ": true, "NM": true, "NY": true, "NC": true, "ND": true, "OH": true,
+	"OK": true, "OR": true, "PA": true, "RI": true, "SC": true, "SD": true, "TN": true, "TX": true, "UT": true,
+	"VT": true, "VA": true, "WA": true, "WV": true, "WI": true, "WY": true,
+}
+
+// normalizeMerchant derives a clean merchant name from a raw statement
+// description, e.g. "SQ *COFFEE 0123 SEATTLE WA" becomes "Coffee". It strips
+// processor prefixes, cuts at the first store or reference code, drops a
+// trailing "CITY ST" location and title-cases the rest. The raw description
+// is left untouched by callers.
+func normalizeMerchant(description string) string {
+	s := merchantPrefixPattern.ReplaceAllString(strings.TrimSpace(description), "")
+	// A "*" separates the merchant from an order reference, as in AMAZON.COM*2K4L1
+	tokens := strings.Fields(strings.ReplaceAll(strings.ToUpper(s), "*", " "))
+
+	for len(tokens) > 0 && isMerchantCode(tokens[0]) {
+		tokens = tokens[1:]
+	}
+	for i, tok := range tokens {
+		if isMerchantCode(tok) {
+			tokens = tokens[:i]
+			break
+		}
+	}
+	if n := len(tokens); n > 2 && usStates[tokens[n-1]] {
+		tokens = tokens[:n-2]
+	}
+
+	for i, tok := range tokens {
+		tok = strings.Trim(tok, "*#-")
+		if tok == "" {
+			continue
+		}
+		tokens[i] = strings.ToUpper(tok[:1]) + strings.ToLower(tok[1:])
+	}
+	name := strings.Join(strings.Fields(strings.Join(tokens, " ")), " ")
+	if name == "" {
+		return strings.Join(strings.Fields(description), " ")
+	}
+	return name
+}
+
+// isMerchantCode reports whether a token is a store number or reference code
+// such as "0123", "#4471" or "X9F2231" rather than part of a name.
+func isMerchantCode(tok string) bool {
+	tok = strings.TrimPrefix(tok, "#")
+	if tok == "" {
+		return false
+	}
+	hasDigit, hasLetter := false, false
+	for _, r := range tok {
+		switch {
+		case r >= '0' && r <= '9':
+			hasDigit = true
+		case r >= 'A' && r <= 'Z':
+			hasLetter = true
+		default:
+			return false
+		}
+	}
+	return hasDigit && (!hasLetter || len(tok) >= 4)
+}
+
+// MerchantStats is one merchant's total in GET /stats/by-merchant.
+type MerchantStats struct {
+	Merchant string          `json:"merchant"`
+	Total    decimal.Decimal `json:"total"`
+	Count    int             `json:"count"`
+}
+
+// getMerchantStats totals transactions per merchant. Transactions entered by
+// hand have no merchant and are grouped by their description instead.
+func (api *API) getMerchantStats(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	filter := activeFilter(c)
+	if err := filter.addDateRange(c); err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	if v := c.Query("type"); v != "" {
+		if !validTransactionTypes[v] {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("invalid type %q: must be debit or credit", v))
+			return
+		}
+		filter.add("type = $%d", v)
+	}
+
+	merchants, err := api.queryMerchantStats(ctx, filter, 0)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, merchants)
+}
+
+const (
+	defaultTopMerchants = 10
+	maxTopMerchants     = 100
+)
+
+// getTopMerchants lists where money goes: the merchants with the largest
+// total debits, biggest first.
+func (api *API) getTopMerchants(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	limit := defaultTopMerchants
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxTopMerchants {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest,
+				fmt.Sprintf("limit must be between 1 and %d", maxTopMerchants))
+			return
+		}
+		limit = n
+	}
+
+	filter := activeFilter(c)
+	if err := filter.addDateRange(c); err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	filter.add("type = $%d", "debit")
+
+	merchants, err := api.queryMerchantStats(ctx, filter, limit)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, merchants)
+}
+
+// queryMerchantStats groups the filtered transactions by merchant, falling
+// back to the description, largest total first. A positive limit keeps only
+// that many groups.
+func (api *API) queryMerchantStats(ctx context.Context, filter *transactionFilter, limit int) ([]MerchantStats, error) {
+	query := "SELECT COALESCE(merchant, description) AS bucket, COALESCE(SUM(amount), 0), COUNT(*) " +
+		"FROM transactions" + filter.where() + " GROUP BY bucket ORDER BY 2 DESC, bucket"
+	args := append([]any(nil), filter.args...)
+	if limit > 0 {
+		args = append(args, limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := api.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	merchants := []MerchantStats{}
+	for rows.Next() {
+		var s MerchantStats
+		if err := rows.Scan(&s.Merchant, &s.Total, &s.Count); err != nil {
+			return nil, err
+		}
+		merchants = append(merchants, s)
+	}
+	return merchants, rows.Err()
+}
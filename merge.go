@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+)
+
+// maxMergeIDs caps how many duplicates one merge may fold into a transaction.
+const maxMergeIDs = 100
+
+type mergeInput struct {
+	KeepID   int   `json:"keep_id" binding:"required"`
+	MergeIDs []int `json:"merge_ids" binding:"required"`
+	// CombineTags copies the merged rows' tags onto the kept one
+	CombineTags bool `json:"combine_tags"`
+	// CombineNotes appends the merged rows' notes to the kept one's
+	CombineNotes bool `json:"combine_notes"`
+	// Force allows merging rows whose amount or currency differ from the
+	// kept row's
+	Force bool `json:"force"`
+}
+
+// mergeTransactions folds duplicates into the transaction being kept: the
+// merged rows are soft-deleted, so they can still be restored, and their tags
+// and notes optionally move over. Rows for a different amount are refused unless
+// forced, since they are unlikely to be the same transaction.
+func (api *API) mergeTransactions(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	var input mergeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if len(input.MergeIDs) == 0 || len(input.MergeIDs) > maxMergeIDs {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest,
+			fmt.Sprintf("merge_ids must contain between 1 and %d entries", maxMergeIDs))
+		return
+	}
+	seen := map[int]bool{input.KeepID: true}
+	mergeIDs := make([]int, 0, len(input.MergeIDs))
+	for _, id := range input.MergeIDs {
+		if id == input.KeepID {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "merge_ids must not include keep_id")
+			return
+		}
+		if !seen[id] {
+			seen[id] = true
+			mergeIDs = append(mergeIDs, id)
+		}
+	}
+
+	userID := currentUserID(c)
+	tx, err := api.db.Begin(ctx)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Locking every row keeps a concurrent edit from slipping in between the
+	// amount check and the delete
+	type mergeRow struct {
+		ID       int
+		Amount   decimal.Decimal
+		Currency string
+	}
+	rows, err := tx.Query(ctx,
+		"SELECT id, amount, currency FROM transactions WHERE user_id = $1 AND deleted_at IS NULL AND id = ANY($2) "+
+			"ORDER BY id FOR UPDATE",
+		userID, append([]int{input.KeepID}, mergeIDs...))
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	locked, err := pgx.CollectRows(rows, pgx.RowToStructByPos[mergeRow])
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	found := make(map[int]mergeRow, len(locked))
+	for _, r := range locked {
+		found[r.ID] = r
+	}
+	keep, ok := found[input.KeepID]
+	if !ok {
+		respondError(c, http.StatusNotFound, codeNotFound, "Transaction not found")
+		return
+	}
+	var notFound, differing []int
+	for _, id := range mergeIDs {
+		r, ok := found[id]
+		switch {
+		case !ok:
+			notFound = append(notFound, id)
+		case !r.Amount.Equal(keep.Amount) || r.Currency != keep.Currency:
+			differing = append(differing, id)
+		}
+	}
+	if len(notFound) > 0 {
+		respondErrorDetails(c, http.StatusNotFound, codeNotFound, "Transactions to merge not found", gin.H{"not_found": notFound})
+		return
+	}
+	if len(differing) > 0 && !input.Force {
+		respondErrorDetails(c, http.StatusConflict, codeConflict,
+			fmt.Sprintf("Transactions differ from the kept amount of %s %s; set force to merge anyway", keep.Amount, keep.Currency),
+			gin.H{"differing": differing})
+		return
+	}
+
+	if input.CombineTags {
+		_, err = tx.Exec(ctx,
+			"INSERT INTO transaction_tags (transaction_id, tag_id) SELECT $1, tag_id FROM transaction_tags "+
+				"WHERE transaction_id = ANY($2) ON CONFLICT DO NOTHING",
+			input.KeepID, mergeIDs)
+		if err != nil {
+			respondDBError(c, err)
+			return
+		}
+	}
+	if input.CombineNotes {
+		// Notes the kept row already has, or that repeat, are added once
+		_, err = tx.Exec(ctx,
+			"UPDATE transactions k SET note = NULLIF(concat_ws(E'\\n', k.note, "+
+				"(SELECT string_agg(DISTINCT m.note, E'\\n') FROM transactions m "+
+				"WHERE m.id = ANY($2) AND m.note <> COALESCE(k.note, ''))), '') WHERE k.id = $1",
+			input.KeepID, mergeIDs)
+		if err != nil {
+			respondDBError(c, err)
+			return
+		}
+	}
+	_, err = tx.Exec(ctx,
+		"UPDATE transactions SET deleted_at = now() WHERE id = ANY($1) AND user_id = $2", mergeIDs, userID)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	var t Transaction
+	err = scanTransaction(tx.QueryRow(ctx,
+		"UPDATE transactions SET version = version + 1 WHERE id = $1 AND user_id = $2 RETURNING "+transactionColumns,
+		input.KeepID, userID), &t)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	api.notifyWebhooks(userID, eventTransactionDeleted, mergeIDs...)
+
+	c.JSON(http.StatusOK, t)
+}
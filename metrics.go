@@ -0,0 +1,108 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsPath = "/metrics"
+
+type metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+}
+
+// newMetrics builds a registry private to one API instance, so constructing
+// several APIs in one process doesn't trip duplicate registration.
+func newMetrics(db Database) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests processed, by method, route and status.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request latency, by method and route.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+	}
+
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if pool, ok := db.(*pgxpool.Pool); ok && pool != nil {
+		m.registry.MustRegister(&poolCollector{pool: pool})
+	}
+	return m
+}
+
+func (m *metrics) handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+}
+
+// middleware records every request except scrapes of the metrics endpoint.
+// Requests are labelled by route template rather than raw path to keep the
+// label set bounded.
+func (m *metrics) middleware(c *gin.Context) {
+	if c.Request.URL.Path == metricsPath {
+		c.Next()
+		return
+	}
+
+	start := time.Now()
+	c.Next()
+
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	m.requests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+	m.requestDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+}
+
+var (
+	poolAcquiredConnsDesc = prometheus.NewDesc("db_pool_acquired_conns", "Connections currently acquired from the pool.", nil, nil)
+	poolIdleConnsDesc     = prometheus.NewDesc("db_pool_idle_conns", "Idle connections in the pool.", nil, nil)
+	poolTotalConnsDesc    = prometheus.NewDesc("db_pool_total_conns", "Total connections in the pool.", nil, nil)
+	poolMaxConnsDesc      = prometheus.NewDesc("db_pool_max_conns", "Maximum size of the pool.", nil, nil)
+	poolAcquireCountDesc  = prometheus.NewDesc("db_pool_acquires_total", "Successful connection acquisitions.", nil, nil)
+	poolEmptyAcquireDesc  = prometheus.NewDesc("db_pool_empty_acquires_total", "Acquisitions that had to wait for a connection.", nil, nil)
+	poolAcquireTimeDesc   = prometheus.NewDesc("db_pool_acquire_duration_seconds_total", "Total time spent acquiring connections.", nil, nil)
+)
+
+// poolCollector exposes pgxpool statistics, read fresh on every scrape.
+type poolCollector struct {
+	pool *pgxpool.Pool
+}
+
+func (p *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolAcquiredConnsDesc
+	ch <- poolIdleConnsDesc
+	ch <- poolTotalConnsDesc
+	ch <- poolMaxConnsDesc
+	ch <- poolAcquireCountDesc
+	ch <- poolEmptyAcquireDesc
+	ch <- poolAcquireTimeDesc
+}
+
+func (p *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := p.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(poolAcquiredConnsDesc, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(poolIdleConnsDesc, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(poolTotalConnsDesc, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(poolMaxConnsDesc, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(poolAcquireCountDesc, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolEmptyAcquireDesc, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolAcquireTimeDesc, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+// migrationsFS holds the versioned schema, applied in filename order.
+//
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// migrate applies any pending migrations to the database behind pool. goose
+// records applied versions in goose_db_version and holds an advisory lock
+// while it runs, so instances starting together do not race.
+func migrate(ctx context.Context, pool *pgxpool.Pool) error {
+	migrations, err := fs.Sub(migrationsFS, "migrations")
+	if err != nil {
+		return err
+	}
+	locker, err := lock.NewPostgresSessionLocker()
+	if err != nil {
+		return err
+	}
+
+	db := stdlib.OpenDBFromPool(pool)
+	defer db.Close()
+
+	provider, err := goose.NewProvider(goose.DialectPostgres, db, migrations, goose.WithSessionLocker(locker))
+	if err != nil {
+		return fmt.Errorf("load migrations: %w", err)
+	}
+	results, err := provider.Up(ctx)
+	if err != nil {
+		return fmt.Errorf("apply migrations: %w", err)
+	}
+	for _, r := range results {
+		log.Printf("Applied migration %s in %s\n", r.Source.Path, r.Duration)
+	}
+	return nil
+}
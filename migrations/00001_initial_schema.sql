@@ -0,0 +1,97 @@
+-- Baseline schema. Statements keep IF NOT EXISTS so databases created from
+-- the old schema.sql adopt this migration without changes.
+
+-- +goose Up
+CREATE TABLE IF NOT EXISTS jobs (
+    job_id          TEXT PRIMARY KEY,
+    status          TEXT NOT NULL,
+    error           TEXT,
+    processed_count INTEGER,
+    total_count     INTEGER,
+    user_id         TEXT NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS accounts (
+    id         SERIAL PRIMARY KEY,
+    user_id    TEXT NOT NULL,
+    name       TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS transactions (
+    id          SERIAL PRIMARY KEY,
+    date        TIMESTAMPTZ NOT NULL,
+    description TEXT NOT NULL,
+    merchant    TEXT,
+    amount      NUMERIC(14, 2) NOT NULL,
+    type        TEXT NOT NULL,
+    category    TEXT,
+    account_id  INTEGER REFERENCES accounts (id),
+    transfer_id TEXT,
+    job_id      TEXT REFERENCES jobs (job_id),
+    cleared     BOOLEAN NOT NULL DEFAULT false,
+    user_id     TEXT NOT NULL,
+    dedup_hash  TEXT,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    deleted_at  TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS transactions_user_date_idx ON transactions (user_id, date);
+CREATE INDEX IF NOT EXISTS jobs_user_idx ON jobs (user_id, created_at);
+CREATE INDEX IF NOT EXISTS transactions_category_idx ON transactions (category);
+CREATE INDEX IF NOT EXISTS transactions_account_idx ON transactions (account_id);
+CREATE INDEX IF NOT EXISTS transactions_transfer_idx ON transactions (transfer_id);
+
+-- Imports skip rows whose fingerprint matches an existing active transaction
+CREATE UNIQUE INDEX IF NOT EXISTS transactions_dedup_idx ON transactions (user_id, dedup_hash)
+    WHERE deleted_at IS NULL;
+
+-- Idempotency-Key values seen on POST /transactions, kept for 24 hours
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    user_id        TEXT NOT NULL,
+    key            TEXT NOT NULL,
+    request_hash   TEXT NOT NULL,
+    transaction_id INTEGER NOT NULL REFERENCES transactions (id),
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, key)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_created_idx ON idempotency_keys (created_at);
+
+-- Announce each new transaction so GET /transactions/stream can push it
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION notify_transaction_created() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('transactions_created', json_build_object('id', NEW.id, 'user_id', NEW.user_id)::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+DROP TRIGGER IF EXISTS transactions_notify_created ON transactions;
+CREATE TRIGGER transactions_notify_created
+    AFTER INSERT ON transactions
+    FOR EACH ROW EXECUTE FUNCTION notify_transaction_created();
+
+-- Portions of a transaction assigned to different categories; their amounts
+-- sum to the parent's
+CREATE TABLE IF NOT EXISTS transaction_splits (
+    id             SERIAL PRIMARY KEY,
+    transaction_id INTEGER NOT NULL REFERENCES transactions (id) ON DELETE CASCADE,
+    amount         NUMERIC(14, 2) NOT NULL,
+    category       TEXT,
+    description    TEXT,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS transaction_splits_transaction_idx ON transaction_splits (transaction_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS transaction_splits;
+DROP TRIGGER IF EXISTS transactions_notify_created ON transactions;
+DROP FUNCTION IF EXISTS notify_transaction_created();
+DROP TABLE IF EXISTS idempotency_keys;
+DROP TABLE IF EXISTS transactions;
+DROP TABLE IF EXISTS accounts;
+DROP TABLE IF EXISTS jobs;
@@ -0,0 +1,8 @@
+-- Row version for optimistic concurrency: PUT and PATCH must send the
+-- version they read, and every update bumps it.
+
+-- +goose Up
+ALTER TABLE transactions ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+-- +goose Down
+ALTER TABLE transactions DROP COLUMN version;
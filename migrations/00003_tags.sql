@@ -0,0 +1,22 @@
+-- Free-form labels, many per transaction. Names are unique per user.
+
+-- +goose Up
+CREATE TABLE tags (
+    id         SERIAL PRIMARY KEY,
+    user_id    TEXT NOT NULL,
+    name       TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE transaction_tags (
+    transaction_id INTEGER NOT NULL REFERENCES transactions (id) ON DELETE CASCADE,
+    tag_id         INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    PRIMARY KEY (transaction_id, tag_id)
+);
+
+CREATE INDEX transaction_tags_tag_idx ON transaction_tags (tag_id);
+
+-- +goose Down
+DROP TABLE transaction_tags;
+DROP TABLE tags;
@@ -0,0 +1,18 @@
+-- Each transaction keeps the currency it was made in. Stats convert to a
+-- base currency using the latest rate here; 1 unit of currency is worth
+-- rate units of base_currency.
+
+-- +goose Up
+ALTER TABLE transactions ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'USD';
+
+CREATE TABLE exchange_rates (
+    currency       CHAR(3) NOT NULL,
+    base_currency  CHAR(3) NOT NULL,
+    rate           NUMERIC(20, 10) NOT NULL CHECK (rate > 0),
+    effective_date DATE NOT NULL DEFAULT CURRENT_DATE,
+    PRIMARY KEY (currency, base_currency, effective_date)
+);
+
+-- +goose Down
+DROP TABLE exchange_rates;
+ALTER TABLE transactions DROP COLUMN currency;
@@ -0,0 +1,30 @@
+-- Fuzzy description search uses pg_trgm when it can be installed. Managed
+-- databases sometimes refuse the extension, so this migration succeeds either
+-- way and the API falls back to ILIKE.
+
+-- +goose Up
+-- +goose StatementBegin
+DO $$
+BEGIN
+    CREATE EXTENSION IF NOT EXISTS pg_trgm;
+EXCEPTION
+    WHEN insufficient_privilege OR undefined_file THEN
+        RAISE NOTICE 'pg_trgm is unavailable; similar search will use ILIKE';
+END
+$$;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_trgm') THEN
+        CREATE INDEX IF NOT EXISTS transactions_description_trgm_idx
+            ON transactions USING GIN (description gin_trgm_ops);
+    END IF;
+END
+$$;
+-- +goose StatementEnd
+
+-- +goose Down
+-- The extension is left installed since other objects may depend on it
+DROP INDEX IF EXISTS transactions_description_trgm_idx;
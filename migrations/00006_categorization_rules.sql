@@ -0,0 +1,18 @@
+-- Rules assign a category to transactions whose description or merchant
+-- matches a pattern. When several rules match, the highest priority wins.
+
+-- +goose Up
+CREATE TABLE categorization_rules (
+    id         SERIAL PRIMARY KEY,
+    user_id    TEXT NOT NULL,
+    pattern    TEXT NOT NULL,
+    match_type TEXT NOT NULL DEFAULT 'ilike' CHECK (match_type IN ('ilike', 'regex')),
+    category   TEXT NOT NULL CHECK (category <> ''),
+    priority   INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX categorization_rules_user_idx ON categorization_rules (user_id, priority DESC);
+
+-- +goose Down
+DROP TABLE categorization_rules;
@@ -0,0 +1,15 @@
+-- Named sets of list query parameters, expanded by GET /transactions?filter=.
+-- params holds the parameters as a JSON object of name to values.
+
+-- +goose Up
+CREATE TABLE saved_filters (
+    id         SERIAL PRIMARY KEY,
+    user_id    TEXT NOT NULL,
+    name       TEXT NOT NULL,
+    params     JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (user_id, name)
+);
+
+-- +goose Down
+DROP TABLE saved_filters;
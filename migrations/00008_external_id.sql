@@ -0,0 +1,11 @@
+-- Sync clients may tag transactions with their own id and upsert on it.
+
+-- +goose Up
+ALTER TABLE transactions ADD COLUMN external_id TEXT;
+
+CREATE UNIQUE INDEX transactions_external_id_idx ON transactions (user_id, external_id)
+    WHERE external_id IS NOT NULL AND deleted_at IS NULL;
+
+-- +goose Down
+DROP INDEX transactions_external_id_idx;
+ALTER TABLE transactions DROP COLUMN external_id;
@@ -0,0 +1,17 @@
+-- Archived transactions, written by POST /transactions/archive before the
+-- originals are soft-deleted. Rows are kept as JSON so later columns don't
+-- need to be mirrored here.
+
+-- +goose Up
+CREATE TABLE transaction_archive (
+    transaction_id INTEGER PRIMARY KEY REFERENCES transactions (id) ON DELETE CASCADE,
+    user_id        TEXT NOT NULL,
+    date           TIMESTAMPTZ NOT NULL,
+    data           JSONB NOT NULL,
+    archived_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX transaction_archive_user_date_idx ON transaction_archive (user_id, date);
+
+-- +goose Down
+DROP TABLE transaction_archive;
@@ -0,0 +1,17 @@
+-- Endpoints notified when the owner's transactions change. Deliveries are
+-- signed with secret.
+
+-- +goose Up
+CREATE TABLE webhooks (
+    id         SERIAL PRIMARY KEY,
+    user_id    TEXT NOT NULL,
+    url        TEXT NOT NULL,
+    events     TEXT[] NOT NULL CHECK (cardinality(events) > 0),
+    secret     TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX webhooks_user_idx ON webhooks (user_id);
+
+-- +goose Down
+DROP TABLE webhooks;
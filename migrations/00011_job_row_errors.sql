@@ -0,0 +1,8 @@
+-- Rows an import skipped as invalid, with their line and raw value, so a
+-- half-successful import says what it left out.
+
+-- +goose Up
+ALTER TABLE jobs ADD COLUMN row_errors JSONB;
+
+-- +goose Down
+ALTER TABLE jobs DROP COLUMN row_errors;
@@ -0,0 +1,8 @@
+-- A free-form annotation such as "reimbursable". It is left out of
+-- dedup_hash, so editing a note never changes duplicate detection.
+
+-- +goose Up
+ALTER TABLE transactions ADD COLUMN note TEXT;
+
+-- +goose Down
+ALTER TABLE transactions DROP COLUMN note;
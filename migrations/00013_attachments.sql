@@ -0,0 +1,19 @@
+-- Files such as receipt images attached to a transaction. The bytes live
+-- under ATTACHMENTS_DIR; storage_key is the file's name there.
+
+-- +goose Up
+CREATE TABLE attachments (
+    id             SERIAL PRIMARY KEY,
+    transaction_id INTEGER NOT NULL REFERENCES transactions (id) ON DELETE CASCADE,
+    user_id        TEXT NOT NULL,
+    filename       TEXT NOT NULL,
+    content_type   TEXT NOT NULL,
+    size           BIGINT NOT NULL,
+    storage_key    TEXT NOT NULL UNIQUE,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX attachments_transaction_idx ON attachments (transaction_id);
+
+-- +goose Down
+DROP TABLE attachments;
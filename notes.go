@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// setTransactionNote replaces a transaction's note without the version
+// round trip a full update needs. A null, missing or blank note clears it.
+func (api *API) setTransactionNote(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	var input struct {
+		Note *string `json:"note" binding:"omitempty,max=1000"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if input.Note != nil && strings.TrimSpace(*input.Note) == "" {
+		input.Note = nil
+	}
+
+	var t Transaction
+	err := scanTransaction(api.db.QueryRow(ctx,
+		"UPDATE transactions SET note = $1, version = version + 1 WHERE id = $2 AND user_id = $3 AND deleted_at IS NULL RETURNING "+transactionColumns,
+		input.Note, c.Param("id"), currentUserID(c)), &t)
+	if errors.Is(err, pgx.ErrNoRows) {
+		respondError(c, http.StatusNotFound, codeNotFound, "Transaction not found")
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, t)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// parseOFX extracts the statement transactions from an OFX file. Both the SGML
+// flavour of OFX 1.x, where leaf tags are never closed, and the XML of OFX 2.x
+// are handled by reading each leaf value up to the next tag. OFX fixes its
+// own date format, so the configured import date layouts don't apply.
+func parseOFX(r io.Reader) (rows []importRow, invalid []importRowError, err error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	doc := string(data)
+	upper := strings.ToUpper(doc)
+	if !strings.Contains(upper, "<OFX>") {
+		return nil, nil, errors.New("file is not a valid OFX document")
+	}
+
+	pos := 0
+	for {
+		start := strings.Index(upper[pos:], "<STMTTRN>")
+		if start < 0 {
+			break
+		}
+		start += pos
+		body := start + len("<STMTTRN>")
+		end := len(upper)
+		for _, closer := range []string{"</STMTTRN>", "<STMTTRN>", "</BANKTRANLIST>"} {
+			if i := strings.Index(upper[body:], closer); i >= 0 && body+i < end {
+				end = body + i
+			}
+		}
+		pos = end
+
+		// The account a FITID belongs to is the nearest ACCTID before it
+		accountID := lastOFXValue(doc[:start], upper[:start], "ACCTID")
+		line := strings.Count(doc[:start], "\n") + 1
+		t, fitid, err := parseOFXTransaction(doc[start:end], upper[start:end])
+		if err != nil {
+			invalid = append(invalid, newImportRowError(line, err))
+			continue
+		}
+		hash := dedupHash(t)
+		if fitid != "" {
+			hash = fitidDedupHash(accountID, fitid)
+		}
+		rows = append(rows, importRow{Transaction: t, DedupHash: hash, Line: line})
+	}
+	return rows, invalid, nil
+}
+
+func parseOFXTransaction(block, upper string) (Transaction, string, error) {
+	var t Transaction
+
+	date, err := parseOFXDate(ofxValue(block, upper, "DTPOSTED"))
+	if err != nil {
+		return t, "", err
+	}
+	t.Date = date
+
+	// OFX amounts are signed from the account holder's point of view, so money
+	// leaving the account is negative
+	amount, err := parseOFXAmount(ofxValue(block, upper, "TRNAMT"))
+	if err != nil {
+		return t, "", err
+	}
+	t.Type = "credit"
+	if amount.IsNegative() {
+		t.Type = "debit"
+	}
+	t.Amount = amount.Abs()
+
+	t.Description = ofxValue(block, upper, "NAME")
+	if t.Description == "" {
+		t.Description = ofxValue(block, upper, "MEMO")
+	}
+	if t.Description == "" {
+		return t, "", errors.New("transaction has no NAME or MEMO")
+	}
+
+	return t, ofxValue(block, upper, "FITID"), nil
+}
+
+// ofxValue returns the text following <tag> in block, up to the next tag.
+// upper is block upper-cased, since OFX tag names are case-insensitive.
+func ofxValue(block, upper, tag string) string {
+	open := "<" + tag + ">"
+	i := strings.Index(upper, open)
+	if i < 0 {
+		return ""
+	}
+	return ofxText(block[i+len(open):])
+}
+
+// lastOFXValue is ofxValue for the final occurrence of tag.
+func lastOFXValue(block, upper, tag string) string {
+	open := "<" + tag + ">"
+	i := strings.LastIndex(upper, open)
+	if i < 0 {
+		return ""
+	}
+	return ofxText(block[i+len(open):])
+}
+
+func ofxText(s string) string {
+	if j := strings.IndexByte(s, '<'); j >= 0 {
+		s = s[:j]
+	}
+	return html.UnescapeString(strings.TrimSpace(s))
+}
+
+// parseOFXDate parses the OFX datetime format YYYYMMDD[HHMMSS[.XXX]][offset:TZ],
+// e.g. 20240115120000.000[-5:EST]. Without an offset the time is taken as UTC.
+func parseOFXDate(s string) (time.Time, error) {
+	raw := s
+	loc := time.UTC
+	if i := strings.IndexByte(s, '['); i >= 0 {
+		zone := strings.TrimSuffix(s[i+1:], "]")
+		s = s[:i]
+		offset, name, _ := strings.Cut(zone, ":")
+		hours, err := strconv.ParseFloat(offset, 64)
+		if err != nil {
+			return time.Time{}, &importValueError{Field: "date", Value: raw}
+		}
+		loc = time.FixedZone(name, int(hours*3600))
+	}
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		s = s[:i]
+	}
+
+	var layout string
+	switch len(s) {
+	case 8:
+		layout = "20060102"
+	case 12:
+		layout = "200601021504"
+	case 14:
+		layout = "20060102150405"
+	default:
+		return time.Time{}, &importValueError{Field: "date", Value: raw}
+	}
+	t, err := time.ParseInLocation(layout, s, loc)
+	if err != nil {
+		return time.Time{}, &importValueError{Field: "date", Value: raw}
+	}
+	return t, nil
+}
+
+// parseOFXAmount parses a signed OFX amount. Some banks use a comma as the
+// decimal separator, which is accepted when no period is present.
+func parseOFXAmount(s string) (decimal.Decimal, error) {
+	v := strings.ReplaceAll(s, " ", "")
+	if strings.Contains(v, ",") && !strings.Contains(v, ".") {
+		v = strings.ReplaceAll(v, ",", ".")
+	}
+	v = strings.ReplaceAll(v, ",", "")
+	d, err := decimal.NewFromString(v)
+	if err != nil {
+		return d, &importValueError{Field: "amount", Value: s}
+	}
+	return d, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ledongthuc/pdf"
+	"github.com/shopspring/decimal"
+)
+
+// maxPDFSize caps uploaded statements, which are held in memory while the
+// background extraction runs.
+const maxPDFSize = 10 << 20
+
+// pdfLinePattern matches a statement line of the form
+//
+//	01/15/2024  COFFEE SHOP  12.34  [1,234.56]
+//
+// where the optional trailing amount is a running balance and is ignored.
+// The date may be separated by slashes, dashes or dots.
+var pdfLinePattern = regexp.MustCompile(
+	`^(\d{1,2}[/.-]\d{1,2}[/.-]\d{2,4}|\d{4}[/-]\d{1,2}[/-]\d{1,2})\s+(.+?)\s+` +
+		`(\(?[-+]?\$?[\d,]+\.\d{2}\)?(?:\s?(?:CR|DR|-))?)` +
+		`(?:\s+[-+]?\$?[\d,]+\.\d{2}(?:\s?(?:CR|DR))?)?$`)
+
+// importPDF accepts a PDF bank statement and extracts its transactions on the
+// worker pool. The response carries the job id to poll via GET /jobs/:id.
+func (api *API) importPDF(c *gin.Context) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		respondUploadError(c, err, "A PDF file upload named \"file\" is required")
+		return
+	}
+	if file.Size > maxPDFSize {
+		respondError(c, http.StatusRequestEntityTooLarge, codeInvalidRequest,
+			fmt.Sprintf("PDF must be at most %d MB", maxPDFSize>>20))
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	defer f.Close()
+
+	dates, err := api.importDateLayouts(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "file is not a PDF")
+		return
+	}
+
+	api.queueImport(c, func() ([]importRow, []importRowError, error) {
+		return extractPDFTransactions(data, dates, api.maxFutureDays)
+	})
+}
+
+// extractPDFTransactions reads the text of each page row by row and keeps the
+// rows that look like statement lines. Lines that look like one but don't
+// parse are reported, with the line's text as their value, as are rows dated
+// more than maxFutureDays ahead.
+func extractPDFTransactions(data []byte, dates dateLayouts, maxFutureDays int) ([]importRow, []importRowError, error) {
+	r, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, errors.New("unable to read PDF")
+	}
+
+	var rows []importRow
+	var invalid []importRowError
+	for i := 1; i <= r.NumPage(); i++ {
+		page := r.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		textRows, err := page.GetTextByRow()
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to read text on page %d", i)
+		}
+		for _, textRow := range textRows {
+			parts := make([]string, 0, len(textRow.Content))
+			for _, text := range textRow.Content {
+				parts = append(parts, text.S)
+			}
+			line := strings.Join(strings.Fields(strings.Join(parts, " ")), " ")
+			t, ok, err := parsePDFLine(line, dates)
+			if err != nil {
+				invalid = append(invalid, importRowError{Value: line, Message: fmt.Sprintf("page %d: %v", i, err)})
+			} else if ok {
+				rows = append(rows, importRow{Transaction: t, DedupHash: dedupHash(t)})
+			}
+		}
+	}
+	rows, invalid = dropFutureRows(rows, invalid, maxFutureDays)
+	return rows, invalid, nil
+}
+
+// parsePDFLine turns a single line of statement text into a transaction.
+// Amounts are treated as debits unless marked as a credit with a leading +
+// or a trailing CR, since statements usually list spending unsigned. Lines
+// that aren't statement lines report false; a statement line whose date
+// doesn't parse reports an error.
+func parsePDFLine(line string, dates dateLayouts) (Transaction, bool, error) {
+	var t Transaction
+	m := pdfLinePattern.FindStringSubmatch(line)
+	if m == nil {
+		return t, false, nil
+	}
+
+	date, err := parseStatementDate(m[1], dates)
+	if err != nil {
+		return t, false, err
+	}
+	t.Date = date
+	t.Description = m[2]
+
+	raw := m[3]
+	t.Type = "debit"
+	if strings.HasSuffix(raw, "CR") || strings.HasPrefix(raw, "+") {
+		t.Type = "credit"
+	}
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' || r == '.' {
+			return r
+		}
+		return -1
+	}, raw)
+	t.Amount, err = decimal.NewFromString(digits)
+	if err != nil || t.Amount.IsZero() {
+		return t, false, nil
+	}
+	return t, true, nil
+}
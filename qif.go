@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// parseQIF extracts transactions from a Quicken Interchange Format file. Each
+// record is a run of lines keyed by their first character and ends with "^".
+// Dates are read with the first of dates that fits.
+func parseQIF(r io.Reader, dates dateLayouts) (rows []importRow, invalid []importRowError, err error) {
+	scanner := bufio.NewScanner(r)
+	fields := make(map[byte]string)
+	lineNo, recordLine := 0, 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			continue
+		case line[0] == '!':
+			// Headers such as !Type:Bank carry nothing per transaction
+			continue
+		case line[0] == '^':
+			if len(fields) > 0 {
+				t, err := parseQIFRecord(fields, dates)
+				if err != nil {
+					invalid = append(invalid, newImportRowError(recordLine, err))
+				} else {
+					rows = append(rows, importRow{Transaction: t, DedupHash: dedupHash(t), Line: recordLine})
+				}
+			}
+			fields = make(map[byte]string)
+		default:
+			if len(fields) == 0 {
+				recordLine = lineNo
+			}
+			// Split transactions repeat S/E/$ lines; only the totals are kept
+			if _, seen := fields[line[0]]; !seen {
+				fields[line[0]] = strings.TrimSpace(line[1:])
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(fields) > 0 {
+		// A final record without a closing ^ is still accepted
+		if t, err := parseQIFRecord(fields, dates); err == nil {
+			rows = append(rows, importRow{Transaction: t, DedupHash: dedupHash(t), Line: recordLine})
+		} else {
+			invalid = append(invalid, newImportRowError(recordLine, err))
+		}
+	}
+	return rows, invalid, nil
+}
+
+func parseQIFRecord(fields map[byte]string, dates dateLayouts) (Transaction, error) {
+	var t Transaction
+
+	date, err := parseStatementDate(fields['D'], dates)
+	if err != nil {
+		return t, err
+	}
+	t.Date = date
+
+	amount := fields['T']
+	if amount == "" {
+		amount = fields['U']
+	}
+	d, err := decimal.NewFromString(strings.ReplaceAll(amount, ",", ""))
+	if err != nil {
+		return t, &importValueError{Field: "amount", Value: amount}
+	}
+	t.Type = "credit"
+	if d.IsNegative() {
+		t.Type = "debit"
+	}
+	t.Amount = d.Abs()
+
+	t.Description = fields['P']
+	if t.Description == "" {
+		t.Description = fields['M']
+	}
+	if t.Description == "" {
+		return t, errors.New("transaction has no payee or memo")
+	}
+
+	if category := fields['L']; category != "" {
+		t.Category = &category
+	}
+	return t, nil
+}
+
+// parseStatementDate reads a QIF or printed statement date with dates.
+// Quicken's M/D'YY form for years after 1999, often space padded as in
+// " 1/ 5'24", is read as M/D/YY.
+func parseStatementDate(s string, dates dateLayouts) (time.Time, error) {
+	if strings.Contains(s, "'") {
+		t, err := dates.parse(strings.NewReplacer("'", "/", " ", "").Replace(s))
+		if err != nil {
+			return t, &importValueError{Field: "date", Value: strings.TrimSpace(s)}
+		}
+		return t, nil
+	}
+	return dates.parse(s)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultRateLimit = 10
+	defaultRateBurst = 20
+
+	// The per-IP limit is looser than the per-user one, since several users
+	// can share an address behind NAT or a proxy
+	defaultIPRateLimit = 50
+	defaultIPRateBurst = 100
+
+	// rateLimitIdleTTL is how long a client's bucket is kept after its last
+	// request. An evicted bucket starts full again, which is harmless once
+	// it has been idle this long.
+	rateLimitIdleTTL = 10 * time.Minute
+)
+
+// rateLimiter holds one token bucket per client.
+type rateLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mu        sync.Mutex
+	clients   map[string]*clientBucket
+	lastSweep time.Time
+}
+
+type clientBucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// newRateLimiter allows each client rps requests per second with bursts of up
+// to burst. A non-positive rps disables limiting.
+func newRateLimiter(rps float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		limit:     rate.Limit(rps),
+		burst:     burst,
+		clients:   make(map[string]*clientBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// reserve takes a token from key's bucket, returning how long the client must
+// wait if none is available.
+func (rl *rateLimiter) reserve(key string, now time.Time) time.Duration {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	// Idle buckets are swept opportunistically rather than from a goroutine
+	if now.Sub(rl.lastSweep) > rateLimitIdleTTL {
+		for k, b := range rl.clients {
+			if now.Sub(b.lastSeen) > rateLimitIdleTTL {
+				delete(rl.clients, k)
+			}
+		}
+		rl.lastSweep = now
+	}
+
+	b, ok := rl.clients[key]
+	if !ok {
+		b = &clientBucket{limiter: rate.NewLimiter(rl.limit, rl.burst)}
+		rl.clients[key] = b
+	}
+	b.lastSeen = now
+
+	r := b.limiter.ReserveN(now, 1)
+	if !r.OK() {
+		return rateLimitIdleTTL
+	}
+	delay := r.DelayFrom(now)
+	if delay > 0 {
+		// The request is rejected, so give the token back
+		r.CancelAt(now)
+	}
+	return delay
+}
+
+// rateLimitIP limits requests per client IP. It runs before requireAuth, so
+// floods of missing or forged tokens are throttled before any JWT is
+// verified.
+func (api *API) rateLimitIP(c *gin.Context) {
+	limitRequest(c, api.ipLimiter, c.ClientIP())
+}
+
+// rateLimit limits authenticated callers per user. It runs after
+// requireAuth, which has already rejected requests without a user.
+func (api *API) rateLimit(c *gin.Context) {
+	limitRequest(c, api.limiter, currentUserID(c))
+}
+
+// limitRequest rejects the request with 429 when key has exhausted its bucket
+// in rl.
+func limitRequest(c *gin.Context, rl *rateLimiter, key string) {
+	if rl.limit <= 0 {
+		c.Next()
+		return
+	}
+
+	if delay := rl.reserve(key, time.Now()); delay > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+		respondError(c, http.StatusTooManyRequests, codeRateLimited, "Rate limit exceeded")
+		return
+	}
+	c.Next()
+}
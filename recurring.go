@@ -0,0 +1,158 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// recurringMinOccurrences is how many charges it takes before a series is
+	// reported; two could easily be coincidence.
+	recurringMinOccurrences = 3
+
+	// recurringMinInterval and recurringMaxInterval bound the days between
+	// consecutive charges of a monthly series. The window allows for short
+	// months and for charges that drift a few days around weekends.
+	recurringMinInterval = 25
+	recurringMaxInterval = 36
+)
+
+// recurringAmountTolerance is the largest fraction by which a charge may
+// differ from the series average, allowing for small price changes and taxes.
+var recurringAmountTolerance = decimal.NewFromFloat(0.1)
+
+// RecurringSeries is a run of transactions that look like a subscription.
+type RecurringSeries struct {
+	Description    string          `json:"description"`
+	Type           string          `json:"type"`
+	Period         string          `json:"period"`
+	AverageAmount  decimal.Decimal `json:"average_amount"`
+	AverageDays    float64         `json:"average_interval_days"`
+	Occurrences    int             `json:"occurrences"`
+	LastDate       time.Time       `json:"last_date"`
+	NextExpected   time.Time       `json:"next_expected_date"`
+	TransactionIDs []int           `json:"transaction_ids"`
+}
+
+// getRecurring detects roughly monthly series with stable amounts in the
+// user's active transactions. It only reads; nothing is flagged in the table.
+func (api *API) getRecurring(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	filter := activeFilter(c)
+	if err := filter.addDateRange(c); err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	if err := filter.addAccount(c); err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	rows, err := api.db.Query(ctx,
+		"SELECT id, date, description, amount, type FROM transactions"+filter.where()+" ORDER BY date, id",
+		filter.args...)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	// Group by normalized description and type so a refund never joins the
+	// series of the charge it reverses
+	groups := make(map[string][]Transaction)
+	for rows.Next() {
+		var t Transaction
+		if err := rows.Scan(&t.ID, &t.Date, &t.Description, &t.Amount, &t.Type); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		key := t.Type + "|" + normalizeRecurringDescription(t.Description)
+		groups[key] = append(groups[key], t)
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	series := []RecurringSeries{}
+	for _, group := range groups {
+		if s, ok := detectMonthlySeries(group); ok {
+			series = append(series, s)
+		}
+	}
+	sort.Slice(series, func(i, j int) bool {
+		return series[i].AverageAmount.GreaterThan(series[j].AverageAmount)
+	})
+
+	c.JSON(http.StatusOK, series)
+}
+
+// normalizeRecurringDescription drops digits and punctuation, which often
+// carry per-charge reference numbers, and collapses whitespace.
+func normalizeRecurringDescription(s string) string {
+	cleaned := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) {
+			return unicode.ToLower(r)
+		}
+		return ' '
+	}, s)
+	return strings.Join(strings.Fields(cleaned), " ")
+}
+
+// detectMonthlySeries reports whether date-ordered transactions form a
+// monthly series: every gap inside the interval window and every amount
+// within tolerance of the average.
+func detectMonthlySeries(group []Transaction) (RecurringSeries, bool) {
+	var s RecurringSeries
+	if len(group) < recurringMinOccurrences {
+		return s, false
+	}
+
+	total := decimal.Zero
+	for _, t := range group {
+		total = total.Add(t.Amount)
+	}
+	average := total.Div(decimal.NewFromInt(int64(len(group)))).Round(2)
+	if average.IsZero() {
+		return s, false
+	}
+	limit := average.Abs().Mul(recurringAmountTolerance)
+	for _, t := range group {
+		if t.Amount.Sub(average).Abs().GreaterThan(limit) {
+			return s, false
+		}
+	}
+
+	var totalDays float64
+	for i := 1; i < len(group); i++ {
+		days := group[i].Date.Sub(group[i-1].Date).Hours() / 24
+		if days < recurringMinInterval || days > recurringMaxInterval {
+			return s, false
+		}
+		totalDays += days
+	}
+
+	last := group[len(group)-1]
+	s = RecurringSeries{
+		Description:   last.Description,
+		Type:          last.Type,
+		Period:        "monthly",
+		AverageAmount: average,
+		AverageDays:   totalDays / float64(len(group)-1),
+		Occurrences:   len(group),
+		LastDate:      last.Date,
+		NextExpected:  last.Date.AddDate(0, 1, 0),
+	}
+	for _, t := range group {
+		s.TransactionIDs = append(s.TransactionIDs, t.ID)
+	}
+	return s, true
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	defaultRelatedLimit = 20
+	maxRelatedLimit     = 100
+)
+
+// getRelatedTransactions lists the caller's other transactions at the same
+// merchant, falling back to the description as the merchant stats do, along
+// with the other leg of a transfer. Newest come first. The list endpoint's
+// filters narrow the results further.
+func (api *API) getRelatedTransactions(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	limit := defaultRelatedLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxRelatedLimit {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest,
+				fmt.Sprintf("limit must be between 1 and %d", maxRelatedLimit))
+			return
+		}
+		limit = n
+	}
+	filter, err := api.parseTransactionFilter(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	id := c.Param("id")
+	var bucket string
+	var transferID *string
+	err = api.db.QueryRow(ctx,
+		"SELECT COALESCE(merchant, description), transfer_id FROM transactions "+
+			"WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL",
+		id, currentUserID(c)).Scan(&bucket, &transferID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		respondError(c, http.StatusNotFound, codeNotFound, "Transaction not found")
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	// A null transfer_id matches nothing, so ordinary transactions only pick
+	// up the merchant match
+	filter.add("id <> $%d", id)
+	filter.add("(COALESCE(merchant, description) = $%d OR transfer_id = $%d)", bucket, transferID)
+
+	args := append(filter.args, limit)
+	rows, err := api.db.Query(ctx,
+		fmt.Sprintf("SELECT %s FROM transactions%s ORDER BY date DESC, id DESC LIMIT $%d",
+			transactionColumns, filter.where(), len(args)),
+		args...)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	related := []Transaction{}
+	for rows.Next() {
+		var t Transaction
+		if err := scanTransaction(rows, &t); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		related = append(related, t)
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, related)
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ruleMatchCondition is true when rule r matches transaction t. ilike
+// patterns are SQL LIKE patterns, so "%coffee%" matches anywhere; regex
+// patterns are POSIX and case-insensitive.
+const ruleMatchCondition = "CASE r.match_type " +
+	"WHEN 'regex' THEN t.description ~* r.pattern OR COALESCE(t.merchant ~* r.pattern, false) " +
+	"ELSE t.description ILIKE r.pattern OR COALESCE(t.merchant ILIKE r.pattern, false) END"
+
+const ruleColumns = "id, pattern, match_type, category, priority, created_at"
+
+// Rule assigns Category to transactions whose description or merchant matches
+// Pattern.
+type Rule struct {
+	ID        int       `json:"id"`
+	Pattern   string    `json:"pattern"`
+	MatchType string    `json:"match_type"`
+	Category  string    `json:"category"`
+	Priority  int       `json:"priority"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func scanRule(row pgx.Row, r *Rule) error {
+	return row.Scan(&r.ID, &r.Pattern, &r.MatchType, &r.Category, &r.Priority, &r.CreatedAt)
+}
+
+type ruleInput struct {
+	Pattern   string `json:"pattern" binding:"required,max=500"`
+	MatchType string `json:"match_type" binding:"omitempty,oneof=ilike regex"`
+	Category  string `json:"category" binding:"required,max=100"`
+	Priority  int    `json:"priority"`
+}
+
+// RulePreview counts the live transactions a rule would match.
+type RulePreview struct {
+	Matches       int `json:"matches"`
+	Uncategorized int `json:"uncategorized"`
+}
+
+// bindRule reads and checks a rule body, writing the error response and
+// returning false when it is unusable. Regex patterns are compiled by
+// Postgres, which is what evaluates them.
+func (api *API) bindRule(ctx context.Context, c *gin.Context) (ruleInput, bool) {
+	var input ruleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return input, false
+	}
+	input.Category = strings.TrimSpace(input.Category)
+	if input.MatchType == "" {
+		input.MatchType = "ilike"
+	}
+
+	var fields []FieldError
+	if strings.TrimSpace(input.Pattern) == "" {
+		fields = append(fields, FieldError{Field: "pattern", Message: "must not be blank"})
+	}
+	if input.Category == "" {
+		fields = append(fields, FieldError{Field: "category", Message: "must not be blank"})
+	}
+	if len(fields) == 0 && input.MatchType == "regex" {
+		_, err := api.db.Exec(ctx, "SELECT '' ~* $1", input.Pattern)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "2201B" {
+			fields = append(fields, FieldError{Field: "pattern", Message: "must be a valid regular expression: " + pgErr.Message})
+		} else if err != nil {
+			respondDBError(c, err)
+			return input, false
+		}
+	}
+	if len(fields) > 0 {
+		respondErrorDetails(c, http.StatusUnprocessableEntity, codeValidationFailed, "Request validation failed", fields)
+		return input, false
+	}
+	return input, true
+}
+
+func (api *API) getRules(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	rows, err := api.db.Query(ctx,
+		"SELECT "+ruleColumns+" FROM categorization_rules WHERE user_id = $1 ORDER BY priority DESC, id", currentUserID(c))
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	rules := []Rule{}
+	for rows.Next() {
+		var r Rule
+		if err := scanRule(rows, &r); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		rules = append(rules, r)
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+func (api *API) getRule(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	var r Rule
+	err := scanRule(api.db.QueryRow(ctx,
+		"SELECT "+ruleColumns+" FROM categorization_rules WHERE id = $1 AND user_id = $2", c.Param("id"), currentUserID(c)), &r)
+	if errors.Is(err, pgx.ErrNoRows) {
+		respondError(c, http.StatusNotFound, codeNotFound, "Rule not found")
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, r)
+}
+
+// createRule saves a rule. It only affects transactions imported afterwards;
+// existing ones are recategorized with POST /transactions/recategorize.
+func (api *API) createRule(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	input, ok := api.bindRule(ctx, c)
+	if !ok {
+		return
+	}
+
+	var r Rule
+	err := scanRule(api.db.QueryRow(ctx,
+		"INSERT INTO categorization_rules (user_id, pattern, match_type, category, priority) "+
+			"VALUES ($1, $2, $3, $4, $5) RETURNING "+ruleColumns,
+		currentUserID(c), input.Pattern, input.MatchType, input.Category, input.Priority), &r)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, r)
+}
+
+func (api *API) updateRule(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	input, ok := api.bindRule(ctx, c)
+	if !ok {
+		return
+	}
+
+	var r Rule
+	err := scanRule(api.db.QueryRow(ctx,
+		"UPDATE categorization_rules SET pattern = $1, match_type = $2, category = $3, priority = $4 "+
+			"WHERE id = $5 AND user_id = $6 RETURNING "+ruleColumns,
+		input.Pattern, input.MatchType, input.Category, input.Priority, c.Param("id"), currentUserID(c)), &r)
+	if errors.Is(err, pgx.ErrNoRows) {
+		respondError(c, http.StatusNotFound, codeNotFound, "Rule not found")
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, r)
+}
+
+// deleteRule removes a rule. Categories it already assigned are kept.
+func (api *API) deleteRule(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	result, err := api.db.Exec(ctx,
+		"DELETE FROM categorization_rules WHERE id = $1 AND user_id = $2", c.Param("id"), currentUserID(c))
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if result.RowsAffected() == 0 {
+		respondError(c, http.StatusNotFound, codeNotFound, "Rule not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Rule deleted"})
+}
+
+// previewRule counts the transactions a rule body would match without saving
+// it, so a pattern can be tuned before it is applied.
+func (api *API) previewRule(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	input, ok := api.bindRule(ctx, c)
+	if !ok {
+		return
+	}
+
+	var p RulePreview
+	err := api.db.QueryRow(ctx,
+		"SELECT COUNT(*), COUNT(*) FILTER (WHERE t.category IS NULL) "+
+			"FROM transactions t, (SELECT $2::text AS pattern, $3::text AS match_type) r "+
+			"WHERE t.user_id = $1 AND t.deleted_at IS NULL AND ("+ruleMatchCondition+")",
+		currentUserID(c), input.Pattern, input.MatchType).Scan(&p.Matches, &p.Uncategorized)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, p)
+}
+
+// RuleResult counts the transactions one rule recategorized.
+type RuleResult struct {
+	RuleID   int    `json:"rule_id"`
+	Pattern  string `json:"pattern"`
+	Category string `json:"category"`
+	Updated  int    `json:"updated"`
+}
+
+type recategorizeResult struct {
+	Scope   string       `json:"scope"`
+	Updated int          `json:"updated"`
+	Rules   []RuleResult `json:"rules"`
+}
+
+// recategorizeTransactions applies the caller's rules in one statement. Each
+// transaction takes the category of its highest-priority matching rule, with
+// the oldest rule winning ties. By default only uncategorized transactions
+// are touched; scope=all re-evaluates every one.
+func (api *API) recategorizeTransactions(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	scope := c.DefaultQuery("scope", "uncategorized")
+	if scope != "uncategorized" && scope != "all" {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest,
+			fmt.Sprintf("invalid scope %q: must be uncategorized or all", scope))
+		return
+	}
+	target := ""
+	if scope == "uncategorized" {
+		target = " AND t.category IS NULL"
+	}
+
+	rules, err := api.applyRules(ctx, currentUserID(c), target)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	result := recategorizeResult{Scope: scope, Rules: rules}
+	for _, r := range rules {
+		result.Updated += r.Updated
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// applyRules recategorizes the user's live transactions that match a rule
+// and satisfy condition, an extra predicate on t whose placeholders start at
+// $2. It reports how many transactions each rule changed.
+func (api *API) applyRules(ctx context.Context, userID, condition string, args ...any) ([]RuleResult, error) {
+	rows, err := api.db.Query(ctx,
+		"WITH matched AS ("+
+			"SELECT DISTINCT ON (t.id) t.id, r.id AS rule_id, r.category "+
+			"FROM transactions t JOIN categorization_rules r ON r.user_id = t.user_id AND ("+ruleMatchCondition+") "+
+			"WHERE t.user_id = $1 AND t.deleted_at IS NULL"+condition+" "+
+			"ORDER BY t.id, r.priority DESC, r.id), "+
+			"updated AS ("+
+			"UPDATE transactions SET category = m.category, version = version + 1 FROM matched m "+
+			"WHERE transactions.id = m.id AND transactions.category IS DISTINCT FROM m.category "+
+			"RETURNING m.rule_id) "+
+			"SELECT r.id, r.pattern, r.category, COUNT(*) FROM updated u JOIN categorization_rules r ON r.id = u.rule_id "+
+			"GROUP BY r.id ORDER BY r.priority DESC, r.id",
+		append([]any{userID}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []RuleResult{}
+	for rows.Next() {
+		var r RuleResult
+		if err := rows.Scan(&r.RuleID, &r.Pattern, &r.Category, &r.Updated); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
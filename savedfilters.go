@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// savedFilterName keeps names usable as a bare query parameter value.
+var savedFilterName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// savedFilterParams whitelists the list parameters a saved filter may carry.
+// Paging position is left out so a saved filter always starts at the top.
+var savedFilterParams = map[string]bool{
+	"from": true, "to": true, "type": true, "category": true, "account_id": true,
+	"cleared": true, "min_amount": true, "max_amount": true, "q": true, "similar": true,
+	"tag": true, "include_deleted": true, "sort": true, "order": true, "limit": true,
+	"with_balance": true, "expand_splits": true, "fields": true,
+}
+
+type SavedFilter struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	Params    url.Values `json:"params"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// validateSavedParams checks params against the whitelist and runs them
+// through the list endpoint's own parsers, so a saved filter can't fail later.
+func (api *API) validateSavedParams(params url.Values) error {
+	if len(params) == 0 {
+		return errors.New("params must not be empty")
+	}
+	for name := range params {
+		if !savedFilterParams[name] {
+			return fmt.Errorf("parameter %q cannot be saved in a filter", name)
+		}
+	}
+
+	c := paramsContext("", params)
+	if _, _, err := api.parsePagination(c); err != nil {
+		return err
+	}
+	if _, err := api.parseTransactionFilter(c); err != nil {
+		return err
+	}
+	if _, err := parseSort(c); err != nil {
+		return err
+	}
+	if _, err := parseFields(c); err != nil {
+		return err
+	}
+	if _, err := parseExpandSplits(c); err != nil {
+		return err
+	}
+	if v := c.Query("with_balance"); v != "" {
+		if _, err := strconv.ParseBool(v); err != nil {
+			return fmt.Errorf("invalid with_balance %q", v)
+		}
+	}
+	return nil
+}
+
+// paramsContext wraps params in a bare gin context acting for userID, so the
+// list endpoint's parsers can read them as if they were a request's query.
+func paramsContext(userID string, params url.Values) *gin.Context {
+	c := &gin.Context{Request: &http.Request{URL: &url.URL{RawQuery: params.Encode()}}}
+	c.Set(userIDKey, userID)
+	return c
+}
+
+// expandSavedFilter replaces the filter query parameter with the saved
+// filter's parameters. Parameters given explicitly on the request win over
+// saved ones. It writes the error response and returns false when the filter
+// doesn't exist.
+func (api *API) expandSavedFilter(ctx context.Context, c *gin.Context) bool {
+	query := c.Request.URL.Query()
+	name := query.Get("filter")
+	if name == "" {
+		return true
+	}
+
+	var params url.Values
+	err := api.db.QueryRow(ctx,
+		"SELECT params FROM saved_filters WHERE user_id = $1 AND name = $2", currentUserID(c), name).Scan(&params)
+	if errors.Is(err, pgx.ErrNoRows) {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("saved filter %q not found", name))
+		return false
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return false
+	}
+
+	query.Del("filter")
+	for k, v := range params {
+		if _, set := query[k]; !set {
+			query[k] = v
+		}
+	}
+	// Must run before anything reads the query, since gin caches it
+	c.Request.URL.RawQuery = query.Encode()
+	return true
+}
+
+func (api *API) getSavedFilters(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	rows, err := api.db.Query(ctx,
+		"SELECT id, name, params, created_at FROM saved_filters WHERE user_id = $1 ORDER BY name", currentUserID(c))
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	filters := []SavedFilter{}
+	for rows.Next() {
+		var f SavedFilter
+		if err := rows.Scan(&f.ID, &f.Name, &f.Params, &f.CreatedAt); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		filters = append(filters, f)
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, filters)
+}
+
+func (api *API) createSavedFilter(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	var input struct {
+		Name   string     `json:"name" binding:"required"`
+		Params url.Values `json:"params" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if !savedFilterName.MatchString(input.Name) {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest,
+			"name must be 1 to 63 lowercase letters, digits, hyphens or underscores")
+		return
+	}
+	if err := api.validateSavedParams(input.Params); err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	f := SavedFilter{Name: input.Name, Params: input.Params}
+	err := api.db.QueryRow(ctx,
+		"INSERT INTO saved_filters (user_id, name, params) VALUES ($1, $2, $3) RETURNING id, created_at",
+		currentUserID(c), f.Name, f.Params).Scan(&f.ID, &f.CreatedAt)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, f)
+}
+
+func (api *API) deleteSavedFilter(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	result, err := api.db.Exec(ctx,
+		"DELETE FROM saved_filters WHERE user_id = $1 AND name = $2", currentUserID(c), c.Param("name"))
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if result.RowsAffected() == 0 {
+		respondError(c, http.StatusNotFound, codeNotFound, "Saved filter not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Saved filter deleted"})
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// similarityThreshold is the pg_trgm default. It is also checked explicitly so
+// results don't change if the server's pg_trgm.similarity_threshold does.
+const similarityThreshold = 0.3
+
+// detectTrigram records whether pg_trgm is installed. Without it, similar
+// searches degrade to a substring match.
+func (api *API) detectTrigram(ctx context.Context) {
+	err := api.db.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_trgm')").Scan(&api.trigram)
+	if err != nil {
+		api.logger.Warn("checking for pg_trgm failed", "error", err)
+		return
+	}
+	if !api.trigram {
+		api.logger.Warn("pg_trgm is not installed; similar search falls back to ILIKE")
+	}
+}
+
+// addSimilar applies the optional similar query parameter, a typo-tolerant
+// description search. It is part of parseTransactionFilter, so every endpoint
+// taking the list filters narrows by it the same way.
+func (api *API) addSimilar(c *gin.Context, f *transactionFilter) {
+	v := strings.TrimSpace(c.Query("similar"))
+	if v == "" {
+		return
+	}
+	if !api.trigram {
+		f.add("description ILIKE '%%' || $%d || '%%'", escapeLike(v))
+		return
+	}
+	// % can use the trigram index; similarity() then applies the fixed cutoff
+	f.add("description %% $%d AND similarity(description, $%d) >= $%d", v, v, similarityThreshold)
+	f.similarArg = len(f.args) - 2
+}
+
+// similarityRank returns an ORDER BY expression ranking the closest similar
+// matches first, or "" when there is no trigram search in f.
+func (f *transactionFilter) similarityRank() string {
+	if f.similarArg == 0 {
+		return ""
+	}
+	return fmt.Sprintf("similarity(description, $%d) DESC", f.similarArg)
+}
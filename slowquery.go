@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const defaultSlowQueryThreshold = 200 * time.Millisecond
+
+type slowQueryStartKey struct{}
+
+type slowQueryStart struct {
+	sql   string
+	start time.Time
+}
+
+// slowQueryTracer logs every Query, QueryRow and Exec on the pool that takes
+// at least threshold, with its SQL and the request that ran it. Arguments
+// are left out since they hold user data. next, when set, is another tracer
+// to chain to, since a pool takes only one.
+type slowQueryTracer struct {
+	threshold time.Duration
+	logger    *slog.Logger
+	next      pgx.QueryTracer
+}
+
+func (t *slowQueryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if t.next != nil {
+		ctx = t.next.TraceQueryStart(ctx, conn, data)
+	}
+	return context.WithValue(ctx, slowQueryStartKey{}, slowQueryStart{sql: data.SQL, start: time.Now()})
+}
+
+func (t *slowQueryTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	if t.next != nil {
+		t.next.TraceQueryEnd(ctx, conn, data)
+	}
+	q, ok := ctx.Value(slowQueryStartKey{}).(slowQueryStart)
+	if !ok {
+		return
+	}
+	elapsed := time.Since(q.start)
+	if elapsed < t.threshold {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("sql", q.sql),
+		slog.Duration("duration", elapsed),
+		slog.Int64("rows", data.CommandTag.RowsAffected()),
+	}
+	if id, ok := ctx.Value(requestIDContextKey{}).(string); ok {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	if data.Err != nil {
+		attrs = append(attrs, slog.String("error", data.Err.Error()))
+	}
+	t.logger.LogAttrs(ctx, slog.LevelWarn, "slow query", attrs...)
+}
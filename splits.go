@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+)
+
+// splitTolerance is how far the splits may drift from the parent amount,
+// absorbing rounding when a receipt is divided by hand.
+var splitTolerance = decimal.New(1, -2)
+
+// Split is one categorised portion of a transaction.
+type Split struct {
+	ID          int             `json:"id"`
+	Amount      decimal.Decimal `json:"amount"`
+	Category    *string         `json:"category"`
+	Description *string         `json:"description"`
+}
+
+type splitInput struct {
+	Amount      *decimal.Decimal `json:"amount" binding:"required,amount"`
+	Category    *string          `json:"category"`
+	Description *string          `json:"description" binding:"omitempty,max=255"`
+}
+
+// setSplits replaces a transaction's splits. An empty array removes them.
+func (api *API) setSplits(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	var input []splitInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	tx, err := api.db.Begin(ctx)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the parent so concurrent edits can't break the sum invariant
+	var t Transaction
+	err = scanTransaction(tx.QueryRow(ctx,
+		"SELECT "+transactionColumns+" FROM transactions WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL FOR UPDATE",
+		c.Param("id"), currentUserID(c)), &t)
+	if errors.Is(err, pgx.ErrNoRows) {
+		respondError(c, http.StatusNotFound, codeNotFound, "Transaction not found")
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	if len(input) > 0 {
+		sum := decimal.Zero
+		for _, s := range input {
+			sum = sum.Add(*s.Amount)
+		}
+		if sum.Sub(t.Amount).Abs().GreaterThan(splitTolerance) {
+			respondError(c, http.StatusUnprocessableEntity, codeValidationFailed,
+				fmt.Sprintf("splits sum to %s but the transaction amount is %s", sum.StringFixed(2), t.Amount.StringFixed(2)))
+			return
+		}
+	}
+
+	if _, err := tx.Exec(ctx, "DELETE FROM transaction_splits WHERE transaction_id = $1", t.ID); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	t.Splits = []Split{}
+	for _, s := range input {
+		split := Split{Amount: *s.Amount, Category: s.Category, Description: s.Description}
+		err := tx.QueryRow(ctx,
+			"INSERT INTO transaction_splits (transaction_id, amount, category, description) VALUES ($1, $2, $3, $4) RETURNING id",
+			t.ID, split.Amount, split.Category, split.Description).Scan(&split.ID)
+		if err != nil {
+			respondDBError(c, err)
+			return
+		}
+		t.Splits = append(t.Splits, split)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, t)
+}
+
+// checkSplitsSum locks transaction id for the rest of tx and reports, as a
+// message, when its splits no longer sum to amount. Unsplit or missing
+// transactions pass; the caller's update reports a missing row itself.
+func checkSplitsSum(ctx context.Context, tx pgx.Tx, id, userID string, amount decimal.Decimal) (string, error) {
+	var locked int
+	err := tx.QueryRow(ctx,
+		"SELECT id FROM transactions WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL FOR UPDATE",
+		id, userID).Scan(&locked)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var count int
+	var sum decimal.Decimal
+	err = tx.QueryRow(ctx,
+		"SELECT COUNT(*), COALESCE(SUM(amount), 0) FROM transaction_splits WHERE transaction_id = $1",
+		locked).Scan(&count, &sum)
+	if err != nil {
+		return "", err
+	}
+	if count > 0 && sum.Sub(amount).Abs().GreaterThan(splitTolerance) {
+		return fmt.Sprintf("splits sum to %s but the new amount is %s; update the splits first",
+			sum.StringFixed(2), amount.StringFixed(2)), nil
+	}
+	return "", nil
+}
+
+// parseExpandSplits reads the expand_splits flag that makes reads include
+// each transaction's splits.
+func parseExpandSplits(c *gin.Context) (bool, error) {
+	v := c.Query("expand_splits")
+	if v == "" {
+		return false, nil
+	}
+	expand, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid expand_splits %q", v)
+	}
+	return expand, nil
+}
+
+// loadSplits attaches the splits of each transaction in one query.
+// Transactions that were never split get an empty list.
+func (api *API) loadSplits(ctx context.Context, transactions []Transaction) error {
+	ids := make([]int, len(transactions))
+	index := make(map[int]int, len(transactions))
+	for i := range transactions {
+		ids[i] = transactions[i].ID
+		index[transactions[i].ID] = i
+		transactions[i].Splits = []Split{}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	rows, err := api.db.Query(ctx,
+		"SELECT transaction_id, id, amount, category, description FROM transaction_splits "+
+			"WHERE transaction_id = ANY($1) ORDER BY id",
+		ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var transactionID int
+		var s Split
+		if err := rows.Scan(&transactionID, &s.ID, &s.Amount, &s.Category, &s.Description); err != nil {
+			return err
+		}
+		t := &transactions[index[transactionID]]
+		t.Splits = append(t.Splits, s)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,574 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/shopspring/decimal"
+)
+
+// MonthlyStats is one month of GET /stats/monthly. Amounts are in
+// BaseCurrency; transactions in a currency with no rate to it are totalled
+// under Unconverted instead, as in Stats.
+type MonthlyStats struct {
+	Month        string           `json:"month"`
+	TotalDebits  decimal.Decimal  `json:"total_debits"`
+	TotalCredits decimal.Decimal  `json:"total_credits"`
+	Net          decimal.Decimal  `json:"net"`
+	Unconverted  []CurrencyTotals `json:"unconverted,omitempty"`
+}
+
+func (api *API) getMonthlyStats(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	loc, err := parseTimezone(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	filter := activeFilter(c)
+	if v := c.Query("year"); v != "" {
+		year, err := strconv.Atoi(v)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid year")
+			return
+		}
+		filter.add("EXTRACT(YEAR FROM date AT TIME ZONE $%d) = $%d", loc.String(), year)
+	}
+
+	// Months are calendar months in tz. Months without any transactions are
+	// omitted rather than zero-filled.
+	source := convertedSource(api.baseCurrency)
+	args := append(filter.args, loc.String())
+	unconverted, err := api.unconvertedTotals(ctx, source,
+		fmt.Sprintf("to_char(date AT TIME ZONE $%d, 'YYYY-MM')", len(args)), "amount", filter, loc.String())
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	rows, err := api.reader().Query(ctx,
+		fmt.Sprintf("SELECT date_trunc('month', date AT TIME ZONE $%d) AS month, ", len(args))+
+			"COALESCE(SUM(base_amount) FILTER (WHERE type = 'debit'), 0), "+
+			"COALESCE(SUM(base_amount) FILTER (WHERE type = 'credit'), 0) "+
+			"FROM "+source+filter.where()+" GROUP BY month ORDER BY month",
+		args...)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	months := []MonthlyStats{}
+	for rows.Next() {
+		var month time.Time
+		var m MonthlyStats
+		if err := rows.Scan(&month, &m.TotalDebits, &m.TotalCredits); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		m.Month = month.Format("2006-01")
+		m.Net = m.TotalCredits.Sub(m.TotalDebits)
+		m.Unconverted = unconverted[m.Month]
+		months = append(months, m)
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, months)
+}
+
+// CategoryStats is one category of GET /stats/by-category, with Total in
+// BaseCurrency and anything without a rate under Unconverted.
+type CategoryStats struct {
+	Category    string           `json:"category"`
+	Total       decimal.Decimal  `json:"total"`
+	Count       int              `json:"count"`
+	Unconverted []CurrencyTotals `json:"unconverted,omitempty"`
+}
+
+func (api *API) getCategoryStats(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	filter := activeFilter(c)
+	if err := filter.addDateRange(c); err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	if v := c.Query("type"); v != "" {
+		if !validTransactionTypes[v] {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("invalid type %q: must be debit or credit", v))
+			return
+		}
+		filter.add("type = $%d", v)
+	}
+
+	// Null categories are grouped under "Uncategorized" so the buckets add up to the overall totals.
+	// Split transactions contribute each split to its own category instead of the parent's,
+	// converted at the parent's rate.
+	const bucket = "COALESCE(s.category, transactions.category, 'Uncategorized')"
+	source := convertedSource(api.baseCurrency) + " LEFT JOIN transaction_splits s ON s.transaction_id = transactions.id"
+	unconverted, err := api.unconvertedTotals(ctx, source, bucket, "COALESCE(s.amount, transactions.amount)", filter)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	rows, err := api.reader().Query(ctx,
+		"SELECT "+bucket+" AS bucket, "+
+			"COALESCE(SUM(COALESCE(s.amount, transactions.amount) * base_rate), 0), COUNT(*) "+
+			"FROM "+source+filter.where()+" GROUP BY bucket ORDER BY 2 DESC",
+		filter.args...)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	categories := []CategoryStats{}
+	for rows.Next() {
+		var s CategoryStats
+		if err := rows.Scan(&s.Category, &s.Total, &s.Count); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		s.Unconverted = unconverted[s.Category]
+		categories = append(categories, s)
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, categories)
+}
+
+const (
+	defaultTrendWindow = 3
+	maxTrendWindow     = 24
+)
+
+// TrendPoint is one month of GET /stats/trends. MovingAverage is the mean net
+// over the trailing window ending at this month, and is null until that many
+// months are available. Both are in BaseCurrency; transactions without a
+// rate to it are left out of them and totalled under Unconverted.
+type TrendPoint struct {
+	Month         string           `json:"month"`
+	Net           decimal.Decimal  `json:"net"`
+	MovingAverage *decimal.Decimal `json:"moving_average"`
+	Unconverted   []CurrencyTotals `json:"unconverted,omitempty"`
+}
+
+func (api *API) getTrends(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	window := defaultTrendWindow
+	if v := c.Query("window"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxTrendWindow {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest,
+				fmt.Sprintf("window must be between 1 and %d months", maxTrendWindow))
+			return
+		}
+		window = n
+	}
+
+	filter := activeFilter(c)
+	if err := filter.addDateRange(c); err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	// Months without activity inside the span are filled with zero, so the
+	// window always covers calendar months rather than months with data. The
+	// frame size can't be a bind parameter; window is a validated int.
+	source := convertedSource(api.baseCurrency)
+	unconverted, err := api.unconvertedTotals(ctx, source, "to_char(date, 'YYYY-MM')", "amount", filter)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	query := fmt.Sprintf("WITH monthly AS ("+
+		"SELECT date_trunc('month', date) AS month, "+
+		"COALESCE(SUM(CASE WHEN type = 'credit' THEN base_amount ELSE -base_amount END), 0) AS net "+
+		"FROM "+source+"%s GROUP BY 1), "+
+		"months AS (SELECT generate_series(MIN(month), MAX(month), interval '1 month') AS month FROM monthly) "+
+		"SELECT months.month, COALESCE(monthly.net, 0), "+
+		"CASE WHEN COUNT(*) OVER w = %d THEN ROUND(AVG(COALESCE(monthly.net, 0)) OVER w, 2) END "+
+		"FROM months LEFT JOIN monthly ON monthly.month = months.month "+
+		"WINDOW w AS (ORDER BY months.month ROWS BETWEEN %d PRECEDING AND CURRENT ROW) "+
+		"ORDER BY months.month", filter.where(), window, window-1)
+
+	rows, err := api.reader().Query(ctx, query, filter.args...)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	points := []TrendPoint{}
+	for rows.Next() {
+		var month time.Time
+		var p TrendPoint
+		if err := rows.Scan(&month, &p.Net, &p.MovingAverage); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		p.Month = month.Format("2006-01")
+		p.Unconverted = unconverted[p.Month]
+		points = append(points, p)
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, points)
+}
+
+const (
+	defaultBalanceSeriesDays = 30
+	maxBalanceSeriesDays     = 366
+)
+
+// BalancePoint is the running balance at the end of one day in the requested
+// timezone.
+type BalancePoint struct {
+	Date    string          `json:"date"`
+	Balance decimal.Decimal `json:"balance"`
+}
+
+// getBalanceSeries returns one point per day between from and to, both
+// inclusive and defaulting to the last 30 days. Balances include everything
+// before from, and days without transactions carry the previous balance.
+func (api *API) getBalanceSeries(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	loc, err := parseTimezone(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	to := calendarDay(time.Now(), false, loc)
+	if v := c.Query("to"); v != "" {
+		t, dateOnly, err := parseDateParam(v)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("invalid to date %q: use RFC3339 or YYYY-MM-DD", v))
+			return
+		}
+		to = calendarDay(t, dateOnly, loc)
+	}
+	from := to.AddDate(0, 0, 1-defaultBalanceSeriesDays)
+	if v := c.Query("from"); v != "" {
+		t, dateOnly, err := parseDateParam(v)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("invalid from date %q: use RFC3339 or YYYY-MM-DD", v))
+			return
+		}
+		from = calendarDay(t, dateOnly, loc)
+	}
+	if from.After(to) {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "from must not be after to")
+		return
+	}
+	if days := int(to.Sub(from).Hours()/24) + 1; days > maxBalanceSeriesDays {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest,
+			fmt.Sprintf("range covers %d days; at most %d are allowed", days, maxBalanceSeriesDays))
+		return
+	}
+
+	filter := activeFilter(c)
+	if err := filter.addAccount(c); err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	filter.add("date < $%d", time.Date(to.Year(), to.Month(), to.Day()+1, 0, 0, 0, 0, loc))
+
+	// Days are calendar days in tz. Everything before from collapses into
+	// the opening balance, and the window sum carries it forward day by day.
+	args := append(filter.args, loc.String(), pgtype.Date{Time: from, Valid: true}, pgtype.Date{Time: to, Valid: true})
+	query := fmt.Sprintf("WITH daily AS ("+
+		"SELECT (date AT TIME ZONE $%d)::date AS day, SUM(CASE WHEN type = 'credit' THEN amount ELSE -amount END) AS net "+
+		"FROM transactions%s GROUP BY 1), "+
+		"opening AS (SELECT COALESCE(SUM(net), 0) AS balance FROM daily WHERE day < $%d), "+
+		"days AS (SELECT generate_series($%d::date, $%d::date, interval '1 day')::date AS day) "+
+		"SELECT days.day, opening.balance + SUM(COALESCE(daily.net, 0)) OVER (ORDER BY days.day) "+
+		"FROM days CROSS JOIN opening LEFT JOIN daily ON daily.day = days.day "+
+		"ORDER BY days.day", len(args)-2, filter.where(), len(args)-1, len(args)-1, len(args))
+
+	rows, err := api.reader().Query(ctx, query, args...)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	points := []BalancePoint{}
+	for rows.Next() {
+		var day time.Time
+		var p BalancePoint
+		if err := rows.Scan(&day, &p.Balance); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		p.Date = day.Format(time.DateOnly)
+		points = append(points, p)
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, points)
+}
+
+// CashflowMonth reports money in against money out for one month. Income is
+// the credit total and expenses the debit total, both in BaseCurrency, with
+// transactions lacking a rate to it under Unconverted.
+type CashflowMonth struct {
+	Month       string           `json:"month"`
+	Income      decimal.Decimal  `json:"income"`
+	Expenses    decimal.Decimal  `json:"expenses"`
+	Net         decimal.Decimal  `json:"net"`
+	Unconverted []CurrencyTotals `json:"unconverted,omitempty"`
+}
+
+// CashflowTotals rolls a year up from January 1 through today, or through
+// December 31 for past years.
+type CashflowTotals struct {
+	Year        int              `json:"year"`
+	Through     string           `json:"through"`
+	Income      decimal.Decimal  `json:"income"`
+	Expenses    decimal.Decimal  `json:"expenses"`
+	Net         decimal.Decimal  `json:"net"`
+	Unconverted []CurrencyTotals `json:"unconverted,omitempty"`
+}
+
+type Cashflow struct {
+	Months     []CashflowMonth `json:"months"`
+	YearToDate CashflowTotals  `json:"year_to_date"`
+}
+
+// getCashflow returns income and expenses per month, for one year when the
+// year parameter is set and for all time otherwise. The year-to-date rollup
+// covers the requested year, or the current one.
+func (api *API) getCashflow(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	now := time.Now().UTC()
+	year := now.Year()
+	filter := activeFilter(c)
+	if v := c.Query("year"); v != "" {
+		y, err := strconv.Atoi(v)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid year")
+			return
+		}
+		year = y
+		filter.add("EXTRACT(YEAR FROM date) = $%d", year)
+	}
+
+	source := convertedSource(api.baseCurrency)
+	unconverted, err := api.unconvertedTotals(ctx, source, "to_char(date, 'YYYY-MM')", "amount", filter)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	rows, err := api.reader().Query(ctx,
+		"SELECT date_trunc('month', date) AS month, "+
+			"COALESCE(SUM(base_amount) FILTER (WHERE type = 'credit'), 0), "+
+			"COALESCE(SUM(base_amount) FILTER (WHERE type = 'debit'), 0) "+
+			"FROM "+source+filter.where()+" GROUP BY month ORDER BY month",
+		filter.args...)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	result := Cashflow{Months: []CashflowMonth{}}
+	for rows.Next() {
+		var month time.Time
+		var m CashflowMonth
+		if err := rows.Scan(&month, &m.Income, &m.Expenses); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		m.Month = month.Format("2006-01")
+		m.Net = m.Income.Sub(m.Expenses)
+		m.Unconverted = unconverted[m.Month]
+		result.Months = append(result.Months, m)
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	// Future-dated transactions are left out of the current year's rollup
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(1, 0, 0)
+	if now.Before(end) {
+		end = now.Truncate(24*time.Hour).AddDate(0, 0, 1)
+	}
+	ytd := CashflowTotals{Year: year, Through: end.AddDate(0, 0, -1).Format(time.DateOnly)}
+	rollup := activeFilter(c)
+	rollup.add("date >= $%d", start)
+	rollup.add("date < $%d", end)
+	err = api.reader().QueryRow(ctx,
+		"SELECT COALESCE(SUM(base_amount) FILTER (WHERE type = 'credit'), 0), "+
+			"COALESCE(SUM(base_amount) FILTER (WHERE type = 'debit'), 0) "+
+			"FROM "+source+rollup.where(),
+		rollup.args...).Scan(&ytd.Income, &ytd.Expenses)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	ytd.Net = ytd.Income.Sub(ytd.Expenses)
+	// The rollup spans a single year, so that is its only bucket
+	unconvertedYTD, err := api.unconvertedTotals(ctx, source, "'ytd'", "amount", rollup)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	ytd.Unconverted = unconvertedYTD["ytd"]
+	result.YearToDate = ytd
+
+	c.JSON(http.StatusOK, result)
+}
+
+// WeekdayStats is one day of the week in GET /stats/by-weekday. Total and
+// Average are in BaseCurrency over the debits that have a rate to it; the
+// rest are totalled under Unconverted. Count covers both.
+type WeekdayStats struct {
+	Day         string           `json:"day"`
+	Total       decimal.Decimal  `json:"total"`
+	Count       int              `json:"count"`
+	Average     decimal.Decimal  `json:"average"`
+	Unconverted []CurrencyTotals `json:"unconverted,omitempty"`
+}
+
+// getWeekdayStats totals debits by the day of the week they fell on in tz.
+// All seven days are returned, Monday first, including days without spending.
+func (api *API) getWeekdayStats(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	loc, err := parseTimezone(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	filter := activeFilter(c)
+	if err := filter.addDateRange(c); err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	filter.add("type = $%d", "debit")
+
+	// ISODOW numbers Monday 1 through Sunday 7, unlike DOW's Sunday 0
+	source := convertedSource(api.baseCurrency)
+	args := append(filter.args, loc.String())
+	dow := fmt.Sprintf("EXTRACT(ISODOW FROM date AT TIME ZONE $%d)::int", len(args))
+	unconverted, err := api.unconvertedTotals(ctx, source, dow+"::text", "amount", filter, loc.String())
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	rows, err := api.reader().Query(ctx,
+		"SELECT "+dow+" AS dow, COALESCE(SUM(base_amount), 0), COUNT(*), COUNT(base_amount) "+
+			"FROM "+source+filter.where()+" GROUP BY dow",
+		args...)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	days := make([]WeekdayStats, 7)
+	for i := range days {
+		days[i] = WeekdayStats{Day: time.Weekday((i + 1) % 7).String(), Total: decimal.Zero, Average: decimal.Zero}
+	}
+	for rows.Next() {
+		var dow int
+		var total decimal.Decimal
+		var count, converted int
+		if err := rows.Scan(&dow, &total, &count, &converted); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		d := &days[dow-1]
+		d.Total, d.Count = total, count
+		if converted > 0 {
+			d.Average = total.Div(decimal.NewFromInt(int64(converted))).Round(2)
+		}
+		d.Unconverted = unconverted[strconv.Itoa(dow)]
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, days)
+}
+
+// Distribution summarizes debit amounts for GET /stats/distribution. The
+// amount fields are null when there are no debits in range.
+type Distribution struct {
+	Currency string           `json:"currency"`
+	Count    int              `json:"count"`
+	Min      *decimal.Decimal `json:"min"`
+	Max      *decimal.Decimal `json:"max"`
+	Mean     *decimal.Decimal `json:"mean"`
+	Median   *decimal.Decimal `json:"median"`
+	P25      *decimal.Decimal `json:"p25"`
+	P75      *decimal.Decimal `json:"p75"`
+	P90      *decimal.Decimal `json:"p90"`
+	P95      *decimal.Decimal `json:"p95"`
+}
+
+// getDistribution reports the shape of spending: percentiles of debit
+// amounts in the base currency, over an optional date range. Debits in a
+// currency without a known rate are left out.
+func (api *API) getDistribution(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	filter := activeFilter(c)
+	if err := filter.addDateRange(c); err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	filter.add("type = $%d", "debit")
+	filter.addCondition("base_amount IS NOT NULL")
+
+	// percentile_cont works in double precision, so its results are rounded
+	// back to cents
+	d := Distribution{Currency: api.baseCurrency}
+	err := api.reader().QueryRow(ctx,
+		"SELECT COUNT(*), MIN(base_amount), MAX(base_amount), ROUND(AVG(base_amount), 2), "+
+			"ROUND(percentile_cont(0.5) WITHIN GROUP (ORDER BY base_amount)::numeric, 2), "+
+			"ROUND(percentile_cont(0.25) WITHIN GROUP (ORDER BY base_amount)::numeric, 2), "+
+			"ROUND(percentile_cont(0.75) WITHIN GROUP (ORDER BY base_amount)::numeric, 2), "+
+			"ROUND(percentile_cont(0.9) WITHIN GROUP (ORDER BY base_amount)::numeric, 2), "+
+			"ROUND(percentile_cont(0.95) WITHIN GROUP (ORDER BY base_amount)::numeric, 2) "+
+			"FROM "+convertedSource(api.baseCurrency)+filter.where(),
+		filter.args...).Scan(&d.Count, &d.Min, &d.Max, &d.Mean, &d.Median, &d.P25, &d.P75, &d.P90, &d.P95)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, d)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultStatsCacheTTL = 30 * time.Second
+
+// statsCache keeps recent GET /stats results per user, keyed by the filter
+// that produced them. Entries expire after ttl and a user's entries are all
+// dropped whenever one of their transactions changes.
+type statsCache struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	users     map[string]map[string]Stats
+	lastSweep time.Time
+}
+
+func newStatsCache(ttl time.Duration) *statsCache {
+	return &statsCache{
+		ttl:       ttl,
+		users:     make(map[string]map[string]Stats),
+		lastSweep: time.Now(),
+	}
+}
+
+// statsCacheKey identifies a filter by its SQL and arguments, so equivalent
+// query strings share an entry.
+func statsCacheKey(f *transactionFilter) string {
+	return f.where() + "\x00" + fmt.Sprint(f.args...)
+}
+
+// get returns the cached stats for key if they are younger than the TTL.
+func (sc *statsCache) get(userID, key string, now time.Time) (Stats, bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	stats, ok := sc.users[userID][key]
+	if !ok || now.Sub(stats.CachedAt) >= sc.ttl {
+		return Stats{}, false
+	}
+	return stats, true
+}
+
+// put stores stats, whose CachedAt must be set, under key.
+func (sc *statsCache) put(userID, key string, stats Stats) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	// Expired entries are swept opportunistically rather than from a goroutine
+	if stats.CachedAt.Sub(sc.lastSweep) > sc.ttl {
+		for u, entries := range sc.users {
+			for k, s := range entries {
+				if stats.CachedAt.Sub(s.CachedAt) >= sc.ttl {
+					delete(entries, k)
+				}
+			}
+			if len(entries) == 0 {
+				delete(sc.users, u)
+			}
+		}
+		sc.lastSweep = stats.CachedAt
+	}
+
+	entries, ok := sc.users[userID]
+	if !ok {
+		entries = make(map[string]Stats)
+		sc.users[userID] = entries
+	}
+	entries[key] = stats
+}
+
+// invalidate drops every cached result for userID.
+func (sc *statsCache) invalidate(userID string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	delete(sc.users, userID)
+}
+
+// invalidateStats clears the caller's cached stats after any successful
+// write. Writes made later by the import workers invalidate separately.
+func (api *API) invalidateStats(c *gin.Context) {
+	c.Next()
+
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return
+	}
+	if c.Writer.Status() < http.StatusBadRequest {
+		api.statsCache.invalidate(currentUserID(c))
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// transactionsChannel is the NOTIFY channel the transactions insert
+	// trigger in the initial migration publishes to.
+	transactionsChannel = "transactions_created"
+
+	// sseKeepAlive is how often an idle stream sends a comment line, well
+	// inside the idle timeouts of common proxies.
+	sseKeepAlive = 15 * time.Second
+
+	// listenRetryDelay is the pause before reconnecting a dropped LISTEN.
+	listenRetryDelay = 5 * time.Second
+
+	// streamBufferSize is how many events a slow client may fall behind
+	// before further events are dropped for it.
+	streamBufferSize = 16
+)
+
+// transactionHub fans out newly inserted transactions to the streams of the
+// user who owns them. The LISTEN connection is only opened once somebody
+// subscribes.
+type transactionHub struct {
+	mu     sync.Mutex
+	subs   map[string]map[chan Transaction]struct{}
+	start  sync.Once
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newTransactionHub() *transactionHub {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &transactionHub{
+		subs:   make(map[string]map[chan Transaction]struct{}),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+func (h *transactionHub) subscribe(userID string) chan Transaction {
+	ch := make(chan Transaction, streamBufferSize)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[userID] == nil {
+		h.subs[userID] = make(map[chan Transaction]struct{})
+	}
+	h.subs[userID][ch] = struct{}{}
+	return ch
+}
+
+func (h *transactionHub) unsubscribe(userID string, ch chan Transaction) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs[userID], ch)
+	if len(h.subs[userID]) == 0 {
+		delete(h.subs, userID)
+	}
+}
+
+func (h *transactionHub) hasSubscribers(userID string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs[userID]) > 0
+}
+
+func (h *transactionHub) publish(userID string, t Transaction) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs[userID] {
+		select {
+		case ch <- t:
+		default:
+		}
+	}
+}
+
+// close ends every open stream and stops the listener. It is registered with
+// http.Server.RegisterOnShutdown, since streams never go idle on their own.
+func (h *transactionHub) close() {
+	h.cancel()
+}
+
+// streamTransactions pushes the current user's new transactions as
+// Server-Sent Events until the client disconnects or the server shuts down.
+func (api *API) streamTransactions(c *gin.Context) {
+	userID := currentUserID(c)
+	api.hub.start.Do(func() { go api.listenForTransactions(api.hub.ctx) })
+
+	ch := api.hub.subscribe(userID)
+	defer api.hub.unsubscribe(userID, ch)
+
+	// The stream stays open indefinitely, so the server's WriteTimeout
+	// would otherwise cut it off
+	disableWriteTimeout(c)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// Stop nginx from buffering the stream
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	ticker := time.NewTicker(sseKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-api.hub.ctx.Done():
+			return
+		case t := <-ch:
+			c.SSEvent("transaction", t)
+			c.Writer.Flush()
+		case <-ticker.C:
+			io.WriteString(c.Writer, ": ping\n\n")
+			c.Writer.Flush()
+		}
+	}
+}
+
+// listenForTransactions keeps a LISTEN open for as long as ctx lives,
+// reconnecting after errors.
+func (api *API) listenForTransactions(ctx context.Context) {
+	for {
+		err := api.listenOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		api.logger.Error("transaction listener stopped", "error", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(listenRetryDelay):
+		}
+	}
+}
+
+func (api *API) listenOnce(ctx context.Context) error {
+	// LISTEN holds a connection of its own, which only a real pool can lend
+	pool, ok := api.db.(*pgxpool.Pool)
+	if !ok {
+		return errors.New("streaming requires a *pgxpool.Pool")
+	}
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// The connection is closed rather than returned, so it never goes back
+	// to the pool still listening
+	defer func() {
+		conn.Conn().Close(context.Background())
+		conn.Release()
+	}()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+transactionsChannel); err != nil {
+		return err
+	}
+
+	for {
+		n, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var payload struct {
+			ID     int    `json:"id"`
+			UserID string `json:"user_id"`
+		}
+		if err := json.Unmarshal([]byte(n.Payload), &payload); err != nil {
+			api.logger.Warn("ignoring malformed notification", "payload", n.Payload)
+			continue
+		}
+		if !api.hub.hasSubscribers(payload.UserID) {
+			continue
+		}
+
+		var t Transaction
+		queryCtx, cancel := context.WithTimeout(ctx, api.queryTimeout)
+		err = scanTransaction(api.db.QueryRow(queryCtx,
+			"SELECT "+transactionColumns+" FROM transactions WHERE id = $1", payload.ID), &t)
+		cancel()
+		if err != nil {
+			api.logger.Warn("unable to load notified transaction", "id", payload.ID, "error", err)
+			continue
+		}
+		api.hub.publish(payload.UserID, t)
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+const maxTagLength = 50
+
+// transactionTagsColumn selects a transaction's tag names, sorted, as part of
+// transactionColumns. It is fully qualified so it resolves against the outer
+// transactions row.
+const transactionTagsColumn = "ARRAY(SELECT tg.name FROM transaction_tags tt JOIN tags tg ON tg.id = tt.tag_id " +
+	"WHERE tt.transaction_id = transactions.id ORDER BY tg.name) AS tags"
+
+type Tag struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// normalizeTag trims and lowercases a tag so "Travel" and "travel " are the
+// same tag.
+func normalizeTag(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return "", errors.New("tag must not be blank")
+	}
+	if len(name) > maxTagLength {
+		return "", fmt.Errorf("tag %q must be at most %d characters", name, maxTagLength)
+	}
+	return name, nil
+}
+
+// normalizeTags normalizes and de-duplicates names, keeping their order.
+func normalizeTags(names []string) ([]string, error) {
+	seen := make(map[string]bool, len(names))
+	tags := make([]string, 0, len(names))
+	for _, name := range names {
+		tag, err := normalizeTag(name)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+// addTags applies the optional, repeatable tag query parameter. A transaction
+// must carry every listed tag to match.
+func (f *transactionFilter) addTags(c *gin.Context) error {
+	values := c.QueryArray("tag")
+	if len(values) == 0 {
+		return nil
+	}
+	tags, err := normalizeTags(values)
+	if err != nil {
+		return err
+	}
+	f.add("id IN (SELECT tt.transaction_id FROM transaction_tags tt JOIN tags tg ON tg.id = tt.tag_id "+
+		"WHERE tg.name = ANY($%d) GROUP BY tt.transaction_id HAVING COUNT(*) = $%d)", tags, len(tags))
+	return nil
+}
+
+func (api *API) getTags(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	rows, err := api.db.Query(ctx,
+		"SELECT id, name, created_at FROM tags WHERE user_id = $1 ORDER BY name", currentUserID(c))
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	tags := []Tag{}
+	for rows.Next() {
+		var t Tag
+		if err := rows.Scan(&t.ID, &t.Name, &t.CreatedAt); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		tags = append(tags, t)
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tags)
+}
+
+// createTag is idempotent: creating a tag that already exists returns it with
+// 200 rather than 201.
+func (api *API) createTag(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	var input struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	name, err := normalizeTag(input.Name)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	t := Tag{Name: name}
+	err = api.db.QueryRow(ctx,
+		"INSERT INTO tags (user_id, name) VALUES ($1, $2) ON CONFLICT (user_id, name) DO NOTHING RETURNING id, created_at",
+		currentUserID(c), name).Scan(&t.ID, &t.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = api.db.QueryRow(ctx,
+			"SELECT id, created_at FROM tags WHERE user_id = $1 AND name = $2", currentUserID(c), name).
+			Scan(&t.ID, &t.CreatedAt)
+		if err != nil {
+			respondDBError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, t)
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, t)
+}
+
+// addTransactionTags attaches tags to a transaction, creating any the user
+// doesn't have yet. Tags it already carries are left alone.
+func (api *API) addTransactionTags(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	var input struct {
+		Tags []string `json:"tags" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	tags, err := normalizeTags(input.Tags)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	userID := currentUserID(c)
+	tx, err := api.db.Begin(ctx)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	if !checkTaggable(ctx, c, tx, c.Param("id")) {
+		return
+	}
+
+	_, err = tx.Exec(ctx,
+		"INSERT INTO tags (user_id, name) SELECT $1, unnest($2::text[]) ON CONFLICT (user_id, name) DO NOTHING",
+		userID, tags)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	_, err = tx.Exec(ctx,
+		"INSERT INTO transaction_tags (transaction_id, tag_id) SELECT $1, id FROM tags WHERE user_id = $2 AND name = ANY($3) "+
+			"ON CONFLICT DO NOTHING",
+		c.Param("id"), userID, tags)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	api.respondTransaction(ctx, c, c.Param("id"))
+}
+
+// removeTransactionTag detaches one tag. Removing a tag the transaction
+// doesn't carry is not an error. The tag itself is kept for reuse.
+func (api *API) removeTransactionTag(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	tag, err := normalizeTag(c.Param("tag"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	if !checkTaggable(ctx, c, api.db, c.Param("id")) {
+		return
+	}
+
+	_, err = api.db.Exec(ctx,
+		"DELETE FROM transaction_tags WHERE transaction_id = $1 AND tag_id IN (SELECT id FROM tags WHERE user_id = $2 AND name = $3)",
+		c.Param("id"), currentUserID(c), tag)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	api.respondTransaction(ctx, c, c.Param("id"))
+}
+
+// checkTaggable confirms the transaction exists and belongs to the caller,
+// writing a 404 when it doesn't.
+func checkTaggable(ctx context.Context, c *gin.Context, q rowQuerier, id string) bool {
+	var exists bool
+	err := q.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM transactions WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)",
+		id, currentUserID(c)).Scan(&exists)
+	if err != nil {
+		respondDBError(c, err)
+		return false
+	}
+	if !exists {
+		respondError(c, http.StatusNotFound, codeNotFound, "Transaction not found")
+		return false
+	}
+	return true
+}
+
+// respondTransaction writes the current state of a transaction.
+func (api *API) respondTransaction(ctx context.Context, c *gin.Context, id string) {
+	var t Transaction
+	err := scanTransaction(api.db.QueryRow(ctx,
+		"SELECT "+transactionColumns+" FROM transactions WHERE id = $1 AND user_id = $2", id, currentUserID(c)), &t)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"time"
+	// The zone database is embedded so tz validation doesn't depend on the
+	// host having one installed
+	_ "time/tzdata"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseTimezone reads the optional tz query parameter, an IANA zone name such
+// as America/New_York, that date-grouped stats bucket by. It defaults to UTC.
+func parseTimezone(c *gin.Context) (*time.Location, error) {
+	v := c.Query("tz")
+	if v == "" {
+		return time.UTC, nil
+	}
+	// Local would mean the server's zone, which is what tz exists to avoid
+	loc, err := time.LoadLocation(v)
+	if err != nil || v == "Local" {
+		return nil, fmt.Errorf("invalid tz %q: must be an IANA timezone name such as America/New_York", v)
+	}
+	return loc, nil
+}
+
+// calendarDay returns the date t falls on in loc, as midnight UTC. Dates given
+// without a time are already calendar days and are kept as they are.
+func calendarDay(t time.Time, dateOnly bool, loc *time.Location) time.Time {
+	if !dateOnly {
+		t = t.In(loc)
+	}
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
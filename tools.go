@@ -0,0 +1,7 @@
+//go:build tools
+
+package main
+
+// gqlgen regenerates the graph package from graph/schema.graphql. Importing it
+// here keeps it in go.mod for go generate.
+import _ "github.com/99designs/gqlgen"
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+type transferInput struct {
+	FromAccountID int              `json:"from_account_id" binding:"required"`
+	ToAccountID   int              `json:"to_account_id" binding:"required"`
+	Amount        *decimal.Decimal `json:"amount" binding:"required,amount"`
+	Date          time.Time        `json:"date" binding:"required"`
+	Description   string           `json:"description" binding:"omitempty,max=255"`
+}
+
+// createTransfer records a movement of money between two of the user's
+// accounts as a debit and a credit sharing a transfer_id. Both rows are
+// written in one database transaction so the legs can't drift apart.
+func (api *API) createTransfer(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	var input transferInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if !api.checkDate(c, &input.Date) {
+		return
+	}
+	if input.FromAccountID == input.ToAccountID {
+		respondErrorDetails(c, http.StatusUnprocessableEntity, codeValidationFailed, "Request validation failed",
+			[]FieldError{{Field: "to_account_id", Message: "must differ from from_account_id"}})
+		return
+	}
+	if !api.checkAccount(ctx, c, &input.FromAccountID) || !api.checkAccount(ctx, c, &input.ToAccountID) {
+		return
+	}
+	if input.Description == "" {
+		input.Description = fmt.Sprintf("Transfer from account %d to account %d", input.FromAccountID, input.ToAccountID)
+	}
+
+	tx, err := api.db.Begin(ctx)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var transferID string
+	if err := tx.QueryRow(ctx, "SELECT gen_random_uuid()::text").Scan(&transferID); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	const insert = "INSERT INTO transactions (date, description, amount, type, account_id, transfer_id, user_id) " +
+		"VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id"
+	var debitID, creditID int
+	err = tx.QueryRow(ctx, insert,
+		input.Date, input.Description, *input.Amount, "debit", input.FromAccountID, transferID, currentUserID(c)).
+		Scan(&debitID)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	err = tx.QueryRow(ctx, insert,
+		input.Date, input.Description, *input.Amount, "credit", input.ToAccountID, transferID, currentUserID(c)).
+		Scan(&creditID)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	api.notifyWebhooks(currentUserID(c), eventTransactionCreated, debitID, creditID)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"transfer_id":           transferID,
+		"debit_transaction_id":  debitID,
+		"credit_transaction_id": creditID,
+	})
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+type transactionUpsert struct {
+	transactionInput
+	ExternalID *string `json:"external_id" binding:"omitempty,min=1,max=255"`
+}
+
+type upsertResult struct {
+	Created     bool        `json:"created"`
+	Transaction Transaction `json:"transaction"`
+}
+
+// upsertTransaction creates a transaction or updates the one it matches, in a
+// single statement so concurrent syncs can't both insert. A matched row with
+// splits only takes an amount its splits still sum to. Bodies with an
+// external_id match on it; others match on the dedup hash, the same
+// fingerprint imports use, so only the fields outside it can change. Updates
+// don't take a version: the caller's copy wins.
+func (api *API) upsertTransaction(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	var input transactionUpsert
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if !api.checkDate(c, &input.Date) {
+		return
+	}
+	if !api.checkAccount(ctx, c, input.AccountID) {
+		return
+	}
+
+	t := Transaction{
+		Date:        input.Date,
+		Description: input.Description,
+		Amount:      *input.Amount,
+		Currency:    input.currency(),
+		Type:        input.Type,
+		Category:    input.Category,
+		Note:        input.Note,
+		AccountID:   input.AccountID,
+		ExternalID:  input.ExternalID,
+	}
+
+	// Rows keyed by external_id skip the hash: two identical purchases on
+	// one day are distinct to a client that numbers them
+	var hash *string
+	conflict := "(user_id, external_id) WHERE external_id IS NOT NULL AND deleted_at IS NULL"
+	match, key := "external_id", any(t.ExternalID)
+	if t.ExternalID == nil {
+		h := dedupHash(t)
+		hash = &h
+		conflict = "(user_id, dedup_hash) WHERE deleted_at IS NULL"
+		match, key = "dedup_hash", hash
+	}
+
+	tx, err := api.db.Begin(ctx)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// An update must leave any splits summing to the new amount, as PUT and
+	// PATCH do, so the matching row is locked and checked first
+	var existing int
+	err = tx.QueryRow(ctx,
+		"SELECT id FROM transactions WHERE user_id = $1 AND "+match+" = $2 AND deleted_at IS NULL FOR UPDATE",
+		currentUserID(c), key).Scan(&existing)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+	case err != nil:
+		respondDBError(c, err)
+		return
+	case !api.checkSplitsForUpdate(ctx, c, tx, strconv.Itoa(existing), t.Amount):
+		return
+	}
+
+	var created bool
+	fields := append(transactionFields(&t), &created)
+	err = tx.QueryRow(ctx,
+		"INSERT INTO transactions (date, description, amount, currency, type, category, note, account_id, external_id, dedup_hash, user_id) "+
+			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) ON CONFLICT "+conflict+" DO UPDATE SET "+
+			"date = EXCLUDED.date, description = EXCLUDED.description, amount = EXCLUDED.amount, currency = EXCLUDED.currency, "+
+			"type = EXCLUDED.type, category = EXCLUDED.category, note = EXCLUDED.note, account_id = EXCLUDED.account_id, "+
+			"version = transactions.version + 1 RETURNING "+transactionColumns+", xmax = 0",
+		t.Date, t.Description, t.Amount, t.Currency, t.Type, t.Category, t.Note, t.AccountID, t.ExternalID, hash, currentUserID(c)).
+		Scan(fields...)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		api.notifyWebhooks(currentUserID(c), eventTransactionCreated, t.ID)
+	}
+	c.JSON(status, upsertResult{Created: created, Transaction: t})
+}
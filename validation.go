@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/shopspring/decimal"
+)
+
+const defaultMaxFutureDays = 366
+
+// maxAmount bounds transaction amounts. Amounts are always positive; the
+// transaction type carries the sign.
+var maxAmount = decimal.NewFromInt(1_000_000_000)
+
+// FieldError describes why a single request field failed validation.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func init() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+
+	// Report fields by their JSON names, which is what clients send
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			return f.Name
+		}
+		return name
+	})
+
+	v.RegisterValidation("transaction_type", func(fl validator.FieldLevel) bool {
+		return validTransactionTypes[fl.Field().String()]
+	})
+	v.RegisterValidation("amount", func(fl validator.FieldLevel) bool {
+		d, ok := fl.Field().Interface().(decimal.Decimal)
+		return ok && d.IsPositive() && d.LessThanOrEqual(maxAmount)
+	})
+	v.RegisterValidation("webhook_url", func(fl validator.FieldLevel) bool {
+		return validWebhookURL(fl.Field().String())
+	})
+	v.RegisterValidation("webhook_event", func(fl validator.FieldLevel) bool {
+		return webhookEvents[fl.Field().String()]
+	})
+}
+
+// futureDateMessage describes the limit on how far ahead a date may be.
+func futureDateMessage(maxFutureDays int) string {
+	return fmt.Sprintf("must not be more than %d days in the future", maxFutureDays)
+}
+
+// tooFarInFuture reports whether t is later than maxFutureDays from now.
+func tooFarInFuture(t time.Time, maxFutureDays int) bool {
+	return !t.Before(time.Now().AddDate(0, 0, maxFutureDays))
+}
+
+// dateErrors reports a date more than the API's MaxFutureDays ahead. Binding
+// can't check it, since the limit is per API rather than per process; a nil
+// date passes.
+func (api *API) dateErrors(date *time.Time) []FieldError {
+	if date == nil || !tooFarInFuture(*date, api.maxFutureDays) {
+		return nil
+	}
+	return []FieldError{{Field: "date", Message: futureDateMessage(api.maxFutureDays)}}
+}
+
+// checkDate answers 422, as respondBindError would, when date fails
+// dateErrors. It returns false once it has responded.
+func (api *API) checkDate(c *gin.Context, date *time.Time) bool {
+	fields := api.dateErrors(date)
+	if fields == nil {
+		return true
+	}
+	respondErrorDetails(c, http.StatusUnprocessableEntity, codeValidationFailed, "Request validation failed", fields)
+	return false
+}
+
+// respondBindError reports a failed ShouldBind. Validation failures get a 422
+// listing each offending field; anything else (malformed JSON, wrong types)
+// is a plain 400.
+func respondBindError(c *gin.Context, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondBodyError(c, err)
+		return
+	}
+
+	var fields []FieldError
+	var verrs validator.ValidationErrors
+	var sliceErrs binding.SliceValidationError
+	switch {
+	case errors.As(err, &verrs):
+		fields = fieldErrors("", verrs)
+	case errors.As(err, &sliceErrs):
+		// Array bodies report each element's fields as [i].field
+		for i, elemErr := range sliceErrs {
+			if errors.As(elemErr, &verrs) {
+				fields = append(fields, fieldErrors(fmt.Sprintf("[%d].", i), verrs)...)
+			}
+		}
+	}
+	if len(fields) == 0 {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	respondErrorDetails(c, http.StatusUnprocessableEntity, codeValidationFailed, "Request validation failed", fields)
+}
+
+func fieldErrors(prefix string, verrs validator.ValidationErrors) []FieldError {
+	fields := make([]FieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		fields = append(fields, FieldError{Field: prefix + fe.Field(), Message: fieldErrorMessage(fe)})
+	}
+	return fields
+}
+
+func fieldErrorMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "min":
+		if fe.Param() == "1" {
+			return "must not be empty"
+		}
+		return fmt.Sprintf("must be at least %s characters", fe.Param())
+	case "max":
+		return fmt.Sprintf("must be at most %s characters", fe.Param())
+	case "transaction_type":
+		return "must be debit or credit"
+	case "amount":
+		return fmt.Sprintf("must be positive and at most %s", maxAmount)
+	case "iso4217":
+		return "must be an uppercase ISO 4217 currency code"
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", strings.Join(strings.Fields(fe.Param()), ", "))
+	case "webhook_url":
+		return "must be an absolute http or https URL whose host resolves to public addresses"
+	case "webhook_event":
+		return fmt.Sprintf("must be %s or %s", eventTransactionCreated, eventTransactionDeleted)
+	default:
+		return fmt.Sprintf("failed %s validation", fe.Tag())
+	}
+}
@@ -0,0 +1,536 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	eventTransactionCreated = "transaction.created"
+	eventTransactionDeleted = "transaction.deleted"
+
+	defaultWebhookWorkers = 2
+
+	// webhookQueueSize bounds how many events may wait for delivery before
+	// new ones are dropped.
+	webhookQueueSize = 1000
+
+	// webhookAttempts is how many times a delivery is tried, backing off
+	// from webhookRetryDelay and doubling between attempts.
+	webhookAttempts   = 5
+	webhookRetryDelay = time.Second
+	webhookTimeout    = 10 * time.Second
+
+	// webhookResolveTimeout bounds the DNS lookup made when a URL is
+	// registered.
+	webhookResolveTimeout = 5 * time.Second
+
+	webhookSignatureHeader = "X-Webhook-Signature"
+	webhookTimestampHeader = "X-Webhook-Timestamp"
+	webhookEventHeader     = "X-Webhook-Event"
+	webhookIDHeader        = "X-Webhook-ID"
+)
+
+var webhookEvents = map[string]bool{
+	eventTransactionCreated: true,
+	eventTransactionDeleted: true,
+}
+
+// webhookColumns lists the columns read by scanWebhook. The secret is only
+// ever returned when a webhook is created.
+const webhookColumns = "id, url, events, created_at"
+
+type Webhook struct {
+	ID        int       `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func scanWebhook(row pgx.Row, w *Webhook) error {
+	return row.Scan(&w.ID, &w.URL, &w.Events, &w.CreatedAt)
+}
+
+type webhookInput struct {
+	URL    string   `json:"url" binding:"required,max=2048,webhook_url"`
+	Events []string `json:"events" binding:"required,min=1,dive,webhook_event"`
+}
+
+// errWebhookAddressBlocked is returned when a delivery would connect to an
+// address that isn't public.
+var errWebhookAddressBlocked = errors.New("webhook address is not public")
+
+// validWebhookURL accepts absolute http and https URLs whose host resolves
+// only to public addresses, so a webhook can't be pointed at the API's own
+// network. Delivery checks again at connect time, since DNS can change.
+func validWebhookURL(v string) bool {
+	u, err := url.Parse(v)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return false
+	}
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil {
+		return publicAddr(addr)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookResolveTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return false
+	}
+	for _, addr := range addrs {
+		if !publicAddr(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// specialPrefixes are the ranges global unicast still admits that are not
+// reachable, or not safely reachable, on the public internet. The IPv6
+// translation prefixes are here because they can embed a private IPv4
+// address.
+var specialPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local NAT64
+	netip.MustParsePrefix("100::/64"),        // discard
+	netip.MustParsePrefix("2001::/23"),       // IETF protocol assignments, including Teredo
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+	netip.MustParsePrefix("2002::/16"),       // 6to4
+	netip.MustParsePrefix("fec0::/10"),       // deprecated site-local
+}
+
+// publicAddr reports whether addr is routable on the internet. Global
+// unicast already excludes loopback, link-local, multicast and unspecified
+// addresses; private and special-purpose ranges are excluded on top.
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, p := range specialPrefixes {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// webhookDialControl refuses connections to addresses publicAddr rejects.
+// It runs after DNS resolution, on every dial including redirects, so a
+// host re-pointed after registration is still caught.
+func webhookDialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !publicAddr(addr) {
+		return fmt.Errorf("%w: %s", errWebhookAddressBlocked, host)
+	}
+	return nil
+}
+
+// newWebhookClient returns the delivery client. It never uses a proxy, so
+// the dial check sees the real destination.
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{Timeout: webhookTimeout, Control: webhookDialControl}
+	return &http.Client{
+		Timeout: webhookTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: webhookTimeout,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
+
+// webhookEvent is a change to one transaction, queued for delivery to the
+// owner's webhooks.
+type webhookEvent struct {
+	userID        string
+	event         string
+	transactionID int
+	at            time.Time
+}
+
+// webhookPayload is the JSON body of a delivery.
+type webhookPayload struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      Transaction `json:"data"`
+}
+
+// webhookDispatcher delivers events off the request path. Queued and
+// retrying deliveries are held in memory, so they are lost on shutdown.
+type webhookDispatcher struct {
+	events chan webhookEvent
+	// retries holds failed deliveries whose backoff has elapsed
+	retries chan webhookDelivery
+	client  *http.Client
+	wg      sync.WaitGroup
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+// startWebhooks launches n delivery workers.
+func (api *API) startWebhooks(n int) {
+	ctx, cancel := context.WithCancel(context.Background())
+	api.webhooks = &webhookDispatcher{
+		events:  make(chan webhookEvent, webhookQueueSize),
+		retries: make(chan webhookDelivery, webhookQueueSize),
+		client:  newWebhookClient(),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	for range n {
+		api.webhooks.wg.Add(1)
+		go func() {
+			defer api.webhooks.wg.Done()
+			for {
+				select {
+				case ev, ok := <-api.webhooks.events:
+					if !ok {
+						return
+					}
+					api.dispatchWebhookEvent(ctx, ev)
+				case d := <-api.webhooks.retries:
+					api.attemptWebhook(ctx, d)
+				}
+			}
+		}()
+	}
+}
+
+// stopWebhooks stops accepting events and waits for queued ones to be
+// delivered, abandoning them when ctx expires. Deliveries still backing off
+// are abandoned straight away.
+func (api *API) stopWebhooks(ctx context.Context) error {
+	close(api.webhooks.events)
+
+	done := make(chan struct{})
+	go func() {
+		api.webhooks.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		api.webhooks.cancel()
+		return nil
+	case <-ctx.Done():
+		api.webhooks.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// notifyWebhooks queues an event without blocking. Handlers call it once the
+// change has committed. Imports and archives stay silent, so a large file or
+// a year-end archive doesn't flood the queue; imports report through their
+// job instead.
+func (api *API) notifyWebhooks(userID, event string, transactionIDs ...int) {
+	for _, id := range transactionIDs {
+		select {
+		case api.webhooks.events <- webhookEvent{userID: userID, event: event, transactionID: id, at: time.Now().UTC()}:
+		default:
+			api.logger.Warn("webhook queue full, dropping event", "event", event, "transaction_id", id)
+		}
+	}
+}
+
+// dispatchWebhookEvent sends ev to every webhook of its owner subscribed to
+// it. The transaction is only loaded when somebody is listening.
+func (api *API) dispatchWebhookEvent(ctx context.Context, ev webhookEvent) {
+	queryCtx, cancel := context.WithTimeout(ctx, api.queryTimeout)
+	defer cancel()
+
+	rows, err := api.db.Query(queryCtx,
+		"SELECT id, url, secret FROM webhooks WHERE user_id = $1 AND $2 = ANY(events)", ev.userID, ev.event)
+	if err != nil {
+		api.logger.Error("loading webhooks failed", "event", ev.event, "error", err)
+		return
+	}
+	type target struct {
+		ID     int
+		URL    string
+		Secret string
+	}
+	targets, err := pgx.CollectRows(rows, pgx.RowToStructByPos[target])
+	if err != nil {
+		api.logger.Error("loading webhooks failed", "event", ev.event, "error", err)
+		return
+	}
+	if len(targets) == 0 {
+		return
+	}
+
+	payload := webhookPayload{Event: ev.event, CreatedAt: ev.at}
+	err = scanTransaction(api.db.QueryRow(queryCtx,
+		"SELECT "+transactionColumns+" FROM transactions WHERE id = $1 AND user_id = $2", ev.transactionID, ev.userID),
+		&payload.Data)
+	if err != nil {
+		api.logger.Error("loading webhook transaction failed", "transaction_id", ev.transactionID, "error", err)
+		return
+	}
+
+	for _, t := range targets {
+		payload.ID = newRequestID()
+		body, err := json.Marshal(payload)
+		if err != nil {
+			api.logger.Error("encoding webhook payload failed", "error", err)
+			return
+		}
+		api.attemptWebhook(ctx, webhookDelivery{
+			webhookID: t.ID,
+			target:    t.URL,
+			secret:    t.Secret,
+			payload:   payload,
+			body:      body,
+			attempt:   1,
+			delay:     webhookRetryDelay,
+		})
+	}
+}
+
+// webhookDelivery is one payload on its way to one webhook.
+type webhookDelivery struct {
+	webhookID int
+	target    string
+	secret    string
+	payload   webhookPayload
+	body      []byte
+	// attempt counts tries so far, including this one; delay is the
+	// backoff before the next
+	attempt int
+	delay   time.Duration
+}
+
+// attemptWebhook makes one try at d. Network errors, 429s and 5xx responses
+// are retried with exponential backoff up to webhookAttempts tries; other
+// statuses are final.
+func (api *API) attemptWebhook(ctx context.Context, d webhookDelivery) {
+	retry, err := api.postWebhook(ctx, d.target, d.secret, d.payload, d.body)
+	if err == nil {
+		return
+	}
+	if !retry || d.attempt == webhookAttempts {
+		api.logger.Warn("webhook delivery failed", "webhook_id", d.webhookID, "delivery_id", d.payload.ID,
+			"event", d.payload.Event, "attempts", d.attempt, "error", err)
+		return
+	}
+	api.scheduleWebhookRetry(d)
+}
+
+// scheduleWebhookRetry requeues d once its backoff elapses. The wait happens
+// on a timer rather than a worker, so one dead endpoint can't stall
+// deliveries to everyone else.
+func (api *API) scheduleWebhookRetry(d webhookDelivery) {
+	wait := d.delay
+	d.attempt++
+	d.delay *= 2
+	time.AfterFunc(wait, func() {
+		if api.webhooks.ctx.Err() != nil {
+			return
+		}
+		select {
+		case api.webhooks.retries <- d:
+		default:
+			api.logger.Warn("webhook retry queue full, dropping delivery", "webhook_id", d.webhookID,
+				"delivery_id", d.payload.ID, "event", d.payload.Event)
+		}
+	})
+}
+
+func (api *API) postWebhook(ctx context.Context, target, secret string, payload webhookPayload, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, payload.Event)
+	req.Header.Set(webhookIDHeader, payload.ID)
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(webhookSignatureHeader, signWebhook(secret, timestamp, body))
+
+	resp, err := api.webhooks.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil && !errors.Is(err, errWebhookAddressBlocked), err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("endpoint returned %d", resp.StatusCode)
+	default:
+		return false, fmt.Errorf("endpoint returned %d", resp.StatusCode)
+	}
+}
+
+// signWebhook returns the X-Webhook-Signature value: an HMAC-SHA256 over the
+// timestamp, a dot and the body. Including the timestamp lets receivers
+// reject replays of old deliveries.
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func newWebhookSecret() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (api *API) getWebhooks(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	rows, err := api.db.Query(ctx,
+		"SELECT "+webhookColumns+" FROM webhooks WHERE user_id = $1 ORDER BY id", currentUserID(c))
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	webhooks := []Webhook{}
+	for rows.Next() {
+		var w Webhook
+		if err := scanWebhook(rows, &w); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		webhooks = append(webhooks, w)
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, webhooks)
+}
+
+func (api *API) getWebhook(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	var w Webhook
+	err := scanWebhook(api.db.QueryRow(ctx,
+		"SELECT "+webhookColumns+" FROM webhooks WHERE id = $1 AND user_id = $2", c.Param("id"), currentUserID(c)), &w)
+	if errors.Is(err, pgx.ErrNoRows) {
+		respondError(c, http.StatusNotFound, codeNotFound, "Webhook not found")
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, w)
+}
+
+// createWebhook registers an endpoint and generates its signing secret. The
+// secret is in this response only.
+func (api *API) createWebhook(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	var input webhookInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	w := Webhook{Secret: newWebhookSecret()}
+	err := scanWebhook(api.db.QueryRow(ctx,
+		"INSERT INTO webhooks (user_id, url, events, secret) VALUES ($1, $2, $3, $4) RETURNING "+webhookColumns,
+		currentUserID(c), input.URL, input.Events, w.Secret), &w)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, w)
+}
+
+// updateWebhook replaces a webhook's URL and events. The secret is kept.
+func (api *API) updateWebhook(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	var input webhookInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	var w Webhook
+	err := scanWebhook(api.db.QueryRow(ctx,
+		"UPDATE webhooks SET url = $1, events = $2 WHERE id = $3 AND user_id = $4 RETURNING "+webhookColumns,
+		input.URL, input.Events, c.Param("id"), currentUserID(c)), &w)
+	if errors.Is(err, pgx.ErrNoRows) {
+		respondError(c, http.StatusNotFound, codeNotFound, "Webhook not found")
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, w)
+}
+
+func (api *API) deleteWebhook(c *gin.Context) {
+	ctx, cancel := api.queryContext(c)
+	defer cancel()
+
+	result, err := api.db.Exec(ctx,
+		"DELETE FROM webhooks WHERE id = $1 AND user_id = $2", c.Param("id"), currentUserID(c))
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if result.RowsAffected() == 0 {
+		respondError(c, http.StatusNotFound, codeNotFound, "Webhook not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+}
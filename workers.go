@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultImportWorkers = 2
+
+	// importQueueSize bounds how many jobs may wait for a worker before new
+	// imports are turned away.
+	importQueueSize = 100
+
+	// importBatchSize is how many rows a worker copies in one go. Progress
+	// is recorded after each batch, trading freshness for fewer writes to
+	// the jobs table.
+	importBatchSize = 500
+)
+
+// errQueueFull is returned by enqueue when every queue slot is taken.
+var errQueueFull = errors.New("import queue is full")
+
+// importTask is one queued import. extract runs on the worker, so slow
+// parsing such as PDF text extraction stays off the request path.
+type importTask struct {
+	jobID   string
+	userID  string
+	extract func() ([]importRow, []importRowError, error)
+}
+
+// workerPool processes queued import jobs with bounded concurrency.
+type workerPool struct {
+	tasks  chan importTask
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// running holds the cancel func of each in-flight job, keyed by job id
+	mu      sync.Mutex
+	running map[string]context.CancelFunc
+}
+
+// startWorkers launches n workers pulling from a shared queue.
+func (api *API) startWorkers(n int) {
+	ctx, cancel := context.WithCancel(context.Background())
+	api.workers = &workerPool{
+		tasks:   make(chan importTask, importQueueSize),
+		ctx:     ctx,
+		cancel:  cancel,
+		running: make(map[string]context.CancelFunc),
+	}
+	for range n {
+		api.workers.wg.Add(1)
+		go func() {
+			defer api.workers.wg.Done()
+			for task := range api.workers.tasks {
+				api.processImport(ctx, task)
+			}
+		}()
+	}
+}
+
+// enqueue hands a task to the pool without blocking the request.
+func (api *API) enqueue(task importTask) error {
+	select {
+	case api.workers.tasks <- task:
+		return nil
+	default:
+		return errQueueFull
+	}
+}
+
+// cancelJob stops the worker processing jobID, if any. It reports whether a
+// worker was running the job.
+func (p *workerPool) cancelJob(jobID string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	cancel, ok := p.running[jobID]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// track registers a per-job context so cancelJob can reach the worker.
+func (p *workerPool) track(ctx context.Context, jobID string) (context.Context, func()) {
+	jobCtx, cancel := context.WithCancel(ctx)
+	p.mu.Lock()
+	p.running[jobID] = cancel
+	p.mu.Unlock()
+
+	return jobCtx, func() {
+		p.mu.Lock()
+		delete(p.running, jobID)
+		p.mu.Unlock()
+		cancel()
+	}
+}
+
+// stopWorkers stops accepting tasks and waits for the queue to drain. If ctx
+// expires first, in-flight jobs are cancelled and marked failed.
+func (api *API) stopWorkers(ctx context.Context) error {
+	close(api.workers.tasks)
+
+	done := make(chan struct{})
+	go func() {
+		api.workers.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		api.workers.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// processImport runs one job to completion. Any failure, including a panic in
+// a parser, marks the job failed rather than taking the server down.
+func (api *API) processImport(ctx context.Context, task importTask) {
+	defer func() {
+		if r := recover(); r != nil {
+			api.logger.Error("import panicked", "job_id", task.jobID, "panic", r)
+			api.failJob(task.jobID, "unable to process import")
+		}
+	}()
+
+	if ctx.Err() != nil {
+		api.failJob(task.jobID, "server shut down before the import started")
+		return
+	}
+
+	// Tracking starts before the status flips to processing, so a cancel can
+	// never land in between and miss the worker
+	jobCtx, done := api.workers.track(ctx, task.jobID)
+	defer done()
+
+	// A job cancelled while still queued is no longer 'queued' and is skipped
+	started, err := api.startJob(task.jobID)
+	if err != nil {
+		api.logger.Error("import status update failed", "job_id", task.jobID, "error", err)
+		return
+	}
+	if !started {
+		return
+	}
+	// Rows land outside any request, so the owner's cached stats are
+	// cleared here instead
+	defer api.statsCache.invalidate(task.userID)
+
+	rows, invalid, err := task.extract()
+	if err != nil {
+		api.failJob(task.jobID, err.Error())
+		return
+	}
+	if len(invalid) > 0 {
+		api.recordRowErrors(task.jobID, invalid)
+	}
+	if len(rows) == 0 {
+		api.failJob(task.jobID, "no transactions found in file")
+		return
+	}
+
+	api.recordProgress(task.jobID, 0, len(rows))
+	for start := 0; start < len(rows); start += importBatchSize {
+		if jobCtx.Err() != nil {
+			api.recordProgress(task.jobID, start, len(rows))
+			api.interruptImport(ctx, task.jobID)
+			return
+		}
+		end := min(start+importBatchSize, len(rows))
+
+		batchCtx, cancel := context.WithTimeout(jobCtx, api.queryTimeout)
+		_, err := api.copyImportRows(batchCtx, task.jobID, task.userID, rows[start:end])
+		cancel()
+		done := start
+		if err != nil && jobCtx.Err() == nil {
+			// The failed batch was rolled back whole. Replaying it a row at
+			// a time keeps the rows ahead of the bad one, as an unbatched
+			// import would, and finds the line to report.
+			api.logger.Warn("import batch failed, retrying row by row", "job_id", task.jobID, "error", err)
+			done, err = api.insertImportRows(jobCtx, task, rows, start, end)
+			if err != nil && jobCtx.Err() == nil {
+				api.logger.Error("import insert failed", "job_id", task.jobID, "error", err)
+				api.recordProgress(task.jobID, done, len(rows))
+				_, _, msg := classifyDBError(err)
+				api.failJob(task.jobID, fmt.Sprintf("%s at %s", strings.ToLower(msg), rowPosition(rows[done], done)))
+				return
+			}
+		}
+		if err != nil {
+			api.recordProgress(task.jobID, done, len(rows))
+			api.interruptImport(ctx, task.jobID)
+			return
+		}
+		api.recordProgress(task.jobID, end, len(rows))
+	}
+
+	// Rows the file left uncategorized pick up the owner's rules. The import
+	// has landed either way, so a failure here is only logged.
+	rulesCtx, cancel := context.WithTimeout(jobCtx, api.queryTimeout)
+	_, err = api.applyRules(rulesCtx, task.userID, " AND t.job_id = $2 AND t.category IS NULL", task.jobID)
+	cancel()
+	if err != nil {
+		api.logger.Warn("applying categorization rules failed", "job_id", task.jobID, "error", err)
+	}
+
+	if err := api.setJobStatus(task.jobID, "completed"); err != nil {
+		api.logger.Error("import status update failed", "job_id", task.jobID, "error", err)
+	}
+}
+
+// insertImportRows inserts rows[start:end] one at a time, returning the index
+// of the row that failed along with its error.
+func (api *API) insertImportRows(ctx context.Context, task importTask, rows []importRow, start, end int) (int, error) {
+	for i := start; i < end; i++ {
+		rowCtx, cancel := context.WithTimeout(ctx, api.queryTimeout)
+		_, err := api.insertImportRow(rowCtx, task.jobID, task.userID, rows[i])
+		cancel()
+		if err != nil {
+			return i, err
+		}
+	}
+	return end, nil
+}
+
+// interruptImport records why a job stopped early. A job cancelled by its
+// owner already has the 'cancelled' status, so only a shutdown is recorded.
+func (api *API) interruptImport(poolCtx context.Context, jobID string) {
+	if poolCtx.Err() != nil {
+		api.failJob(jobID, "server shut down before the import finished")
+	}
+}
+
+func (api *API) recordRowErrors(jobID string, rowErrors []importRowError) {
+	if err := api.setJobRowErrors(jobID, rowErrors); err != nil {
+		api.logger.Error("import row errors update failed", "job_id", jobID, "error", err)
+	}
+}
+
+func (api *API) recordProgress(jobID string, processed, total int) {
+	if err := api.setJobProgress(jobID, processed, total); err != nil {
+		api.logger.Error("import progress update failed", "job_id", jobID, "error", err)
+	}
+}
+
+// rowPosition describes where a row came from for error messages, preferring
+// its line in the source file.
+func rowPosition(row importRow, index int) string {
+	if row.Line > 0 {
+		return fmt.Sprintf("line %d", row.Line)
+	}
+	return fmt.Sprintf("transaction %d", index+1)
+}